@@ -9,22 +9,26 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/neoseele/tiddles/pkg/db"
 	"github.com/neoseele/tiddles/pkg/dns"
 	"github.com/neoseele/tiddles/pkg/dump"
 	g "github.com/neoseele/tiddles/pkg/grpc"
+	personpb "github.com/neoseele/tiddles/pkg/grpc/person"
 	"github.com/neoseele/tiddles/pkg/probe"
 	"github.com/neoseele/tiddles/pkg/stress"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
 	"google.golang.org/grpc/credentials"
 	pb "google.golang.org/grpc/examples/helloworld/helloworld"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
-	mgo "gopkg.in/mgo.v2"
+	"google.golang.org/grpc/reflection"
 
 	"contrib.go.opencensus.io/exporter/stackdriver"
 	"contrib.go.opencensus.io/exporter/stackdriver/propagation"
@@ -75,7 +79,7 @@ func loggingMiddleware(next http.Handler) http.Handler {
 }
 
 // start server
-func runServer(router *mux.Router, httpPort string, httpsPort string, grpcPort string, zpagesPort string, tlsCert string, tlsKey string) chan error {
+func runServer(router *mux.Router, store db.Store, health *g.HealthServer, httpPort string, httpsPort string, grpcPort string, zpagesPort string, tlsCert string, tlsKey string) chan error {
 	errs := make(chan error)
 
 	// Starting HTTP server
@@ -125,7 +129,14 @@ func runServer(router *mux.Router, httpPort string, httpsPort string, grpcPort s
 
 		s := grpc.NewServer(grpcOptions...)
 		pb.RegisterGreeterServer(s, &g.GreeterServer{})
-		healthpb.RegisterHealthServer(s, &g.HealthServer{})
+		personpb.RegisterPersonServiceServer(s, &g.PersonServer{Store: store})
+		healthpb.RegisterHealthServer(s, health)
+		// let grpcurl & co list and call the services without the proto files
+		reflection.Register(s)
+		channelz.RegisterChannelzServiceToServer(s)
+		for name := range s.GetServiceInfo() {
+			health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+		}
 		if err := s.Serve(lis); err != nil {
 			errs <- err
 		}
@@ -134,6 +145,15 @@ func runServer(router *mux.Router, httpPort string, httpsPort string, grpcPort s
 	go func() {
 		mux := http.NewServeMux()
 		zpages.Handle(mux, "/")
+		certFile := ""
+		if tlsCert != "" && tlsKey != "" {
+			certFile = tlsCert
+		}
+		channelzPage, err := g.NewChannelzPage("localhost:"+grpcPort, certFile)
+		if err != nil {
+			log.Fatalf("Invalid TLS certificate: %v\n", err)
+		}
+		mux.Handle("/channelz", channelzPage)
 
 		addr := ":" + zpagesPort
 		log.Printf("Staring zPages HTTP service on %s ...", zpagesPort)
@@ -179,6 +199,38 @@ func initStackdriverTracing() {
 	log.Printf("could not initialize Stackdriver exporter after retrying, giving up")
 }
 
+// envOr returns the value of the env variable name, or def if it is not set
+func envOr(name string, def string) string {
+	if fromEnv := os.Getenv(name); fromEnv != "" {
+		return fromEnv
+	}
+	return def
+}
+
+// envInt is envOr for int values
+func envInt(name string, def int) int {
+	if fromEnv := os.Getenv(name); fromEnv != "" {
+		n, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", name, err)
+		}
+		return n
+	}
+	return def
+}
+
+// envDuration is envOr for durations
+func envDuration(name string, def time.Duration) time.Duration {
+	if fromEnv := os.Getenv(name); fromEnv != "" {
+		d, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", name, err)
+		}
+		return d
+	}
+	return def
+}
+
 // main function to boot up everything
 func main() {
 
@@ -193,6 +245,47 @@ func main() {
 	grpcBeAddr := flag.String("grpc-backend", "", "Specify a grpc backend address [localhost:50000] (default: none)")
 	clientOnly := flag.Bool("client-only", false, "Run as client (default: false")
 	doTrace := flag.Bool("trace", false, "Enable Stackdriver Tracing (default: false)")
+
+	// mongodb options, the env variables (e.g. MONGODB_DATABASE for --mongodb-database) set the defaults
+	mongoOpts := db.MongoOptions{}
+	flag.StringVar(&mongoOpts.URL, "mongodb-url", os.Getenv("MONGODB_URL"), "Specify a MongoDB connection string (default: none)")
+	flag.StringVar(&mongoOpts.Database, "mongodb-database", envOr("MONGODB_DATABASE", "test"), "Specify the MongoDB database (default: test)")
+	flag.StringVar(&mongoOpts.Collection, "mongodb-collection", envOr("MONGODB_COLLECTION", "people"), "Specify the MongoDB collection (default: people)")
+	flag.StringVar(&mongoOpts.AuthSource, "mongodb-auth-source", os.Getenv("MONGODB_AUTH_SOURCE"), "Specify the database to authenticate against (default: from the url)")
+	flag.IntVar(&mongoOpts.PoolLimit, "mongodb-pool-limit", envInt("MONGODB_POOL_LIMIT", 0), "Specify the max number of connections per server (default: 4096)")
+	flag.DurationVar(&mongoOpts.Timeout, "mongodb-timeout", envDuration("MONGODB_TIMEOUT", 10*time.Second), "Specify the timeout to connect (default: 10s)")
+	flag.DurationVar(&mongoOpts.SocketTimeout, "mongodb-socket-timeout", envDuration("MONGODB_SOCKET_TIMEOUT", time.Minute), "Specify the timeout of each operation (default: 1m)")
+	flag.StringVar(&mongoOpts.ReadPreference, "mongodb-read-preference", envOr("MONGODB_READ_PREFERENCE", "primary"),
+		"Specify the read preference [primary|primaryPreferred|secondary|secondaryPreferred|nearest] (default: primary)")
+	flag.BoolVar(&mongoOpts.TLS, "mongodb-tls", os.Getenv("MONGODB_TLS") == "true", "Connect to MongoDB with TLS (default: false)")
+	flag.StringVar(&mongoOpts.CACert, "mongodb-ca-cert", os.Getenv("MONGODB_CA_CERT"), "Specify a CA file to verify MongoDB with, implies --mongodb-tls (default: none)")
+	flag.IntVar(&mongoOpts.Retries, "mongodb-retries", envInt("MONGODB_RETRIES", 0), "Specify the number of times to retry connecting at startup, 0 retries forever (default: 0)")
+	flag.DurationVar(&mongoOpts.RetryInterval, "mongodb-retry-interval", envDuration("MONGODB_RETRY_INTERVAL", 5*time.Second), "Specify the interval between connection retries (default: 5s)")
+
+	// dump
+	dumpDir := flag.String("dump-dir", envOr("DUMP_DIR", "/data"), "Specify the directory served under /dump (default: /data)")
+	dumpMaxSize := flag.Int64("dump-max-size", int64(envInt("DUMP_MAX_SIZE", 10<<20)), "Specify the max size in bytes of a file served under /dump (default: 10MB)")
+	dumpDisable := flag.Bool("dump-disable", os.Getenv("DUMP_DISABLE") == "true", "Disable the /dump endpoints (default: false)")
+	dumpUpload := flag.Bool("dump-upload", os.Getenv("DUMP_UPLOAD") == "true", "Enable the uploads to /dump (default: false)")
+	dumpMaxTotalSize := flag.Int64("dump-max-total-size", int64(envInt("DUMP_MAX_TOTAL_SIZE", 1<<30)), "Specify the max total size in bytes of the files under /dump, for the uploads (default: 1GB)")
+	dumpMaxFiles := flag.Int("dump-max-files", envInt("DUMP_MAX_FILES", 10000), "Specify the max number of files under /dump, for the uploads (default: 10000)")
+	collectKinds := flag.String("collect", os.Getenv("COLLECT"),
+		"Specify the kinds to collect from the Kubernetes API into the dump directory, e.g. nodes,pods,events (default: none)")
+	collectOpts := dump.CollectorOptions{}
+	flag.StringVar(&collectOpts.Host, "collect-api", os.Getenv("COLLECT_API"), "Specify the Kubernetes API server url (default: in-cluster)")
+	flag.StringVar(&collectOpts.TokenFile, "collect-token", os.Getenv("COLLECT_TOKEN"), "Specify the token file (default: the service account token)")
+	flag.StringVar(&collectOpts.CACert, "collect-ca-cert", os.Getenv("COLLECT_CA_CERT"), "Specify the CA file of the API server (default: the service account CA)")
+	flag.StringVar(&collectOpts.Namespace, "collect-namespace", os.Getenv("COLLECT_NAMESPACE"), "Specify the namespace to collect the namespaced kinds from (default: all)")
+	flag.DurationVar(&collectOpts.Interval, "collect-interval", envDuration("COLLECT_INTERVAL", 5*time.Minute), "Specify the interval between collections (default: 5m)")
+
+	// gRPC health
+	grpcHealthAdmin := flag.Bool("grpc-health-admin", os.Getenv("GRPC_HEALTH_ADMIN") == "true", "Enable PUT /grpc/health to change the status of the gRPC services (default: false)")
+
+	// readiness
+	readinessDB := flag.Bool("readiness-db", os.Getenv("READINESS_DB") == "true", "Fail the readiness probe when the database is down (default: false)")
+	readinessDBTimeout := flag.Duration("readiness-db-timeout", envDuration("READINESS_DB_TIMEOUT", 2*time.Second), "Specify the timeout to ping the database (default: 2s)")
+	readinessDBThreshold := flag.Int("readiness-db-failure-threshold", envInt("READINESS_DB_FAILURE_THRESHOLD", 3),
+		"Specify the number of failed pings in a row before the readiness probe fails (default: 3)")
 	flag.Parse()
 
 	// run as client
@@ -206,8 +299,30 @@ func main() {
 		go initStackdriverTracing()
 	}
 
-	// set mongodb connection string if specified via env
-	mongoDbURL := os.Getenv("MONGODB_URL")
+	// set sql connection string (and driver: postgres or mysql) if specified via env
+	sqlDSN := os.Getenv("SQL_DSN")
+	sqlDriver := os.Getenv("SQL_DRIVER")
+	if sqlDriver == "" {
+		sqlDriver = "postgres"
+	}
+
+	// set redis connection string if specified via env, redis is used as a
+	// cache in front of mongodb/sql if either of them is set, otherwise as the store
+	redisOpts := db.RedisOptions{
+		URL:    os.Getenv("REDIS_URL"),
+		CACert: os.Getenv("REDIS_CA_CERT"),
+	}
+	// set the directory of the file store if specified via env, e.g. a PersistentVolume mounted at /data
+	fileDir := os.Getenv("DB_DIR")
+
+	redisCacheTTL := 60 * time.Second
+	if fromEnv := os.Getenv("REDIS_CACHE_TTL"); fromEnv != "" {
+		d, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		redisCacheTTL = d
+	}
 
 	router := mux.NewRouter()
 	router.NotFoundHandler = loggingMiddleware(http.HandlerFunc(NotFound))
@@ -216,19 +331,72 @@ func main() {
 	router.HandleFunc("/error", Error).Methods("GET")
 
 	// db
-	if mongoDbURL != "" {
-		session, err := mgo.Dial(mongoDbURL)
+	var store db.Store
+	if mongoOpts.URL != "" {
+		session, err := db.DialMongo(mongoOpts)
 		if err != nil {
 			panic(err)
 		}
 		defer session.Close()
-		db.Init(session)
+		store, err = db.NewMongoStore(session, mongoOpts.Database, mongoOpts.Collection)
+		if err != nil {
+			panic(err)
+		}
+
+	} else if sqlDSN != "" {
+		s, err := db.NewSQLStore(sqlDriver, sqlDSN)
+		if err != nil {
+			panic(err)
+		}
+		defer s.Close()
+		store = s
+
+	} else if redisOpts.URL != "" {
+		s, err := db.NewRedisStore(redisOpts)
+		if err != nil {
+			panic(err)
+		}
+		defer s.Close()
+		store = s
+
+	} else if fileDir != "" {
+		s, err := db.NewFileStore(fileDir)
+		if err != nil {
+			panic(err)
+		}
+		defer s.Close()
+		store = s
 
 	} else {
-		db.Init(nil)
+		store = db.NewMemoryStore()
 	}
+	// stores without a change feed of their own (e.g. a standalone mongod)
+	// publish the changes made through this process
+	store = db.NewEventStore(store)
+	// record who changed what, for the history and point-in-time reads
+	h, err := db.NewHistoryStore(store)
+	if err != nil {
+		panic(err)
+	}
+	store = h
+	if redisOpts.URL != "" && (mongoOpts.URL != "" || sqlDSN != "") {
+		s, err := db.NewCachedStore(store, redisOpts, redisCacheTTL)
+		if err != nil {
+			panic(err)
+		}
+		defer s.Close()
+		store = s
+	}
+	db.Init(store)
 	router.HandleFunc("/db", db.GetAll).Methods("GET")
+	router.HandleFunc("/db/info", db.Info).Methods("GET")
+	router.HandleFunc("/db/load", db.Load).Methods("POST")
+	router.HandleFunc("/db/seed", db.Seed).Methods("POST")
+	router.HandleFunc("/db/import", db.Import).Methods("POST")
+	router.HandleFunc("/db/export", db.Export).Methods("GET")
+	router.HandleFunc("/db/watch", db.Watch).Methods("GET")
 	router.HandleFunc("/db/{id:[0-9]+}", db.Get).Methods("GET")
+	router.HandleFunc("/db/{id:[0-9]+}/history", db.History).Methods("GET")
 	router.HandleFunc("/db/{id:[0-9]+}", db.Create).Methods("POST")
 	router.HandleFunc("/db/{id:[0-9]+}", db.Update).Methods("PUT")
 	router.HandleFunc("/db/{id:[0-9]+}", db.Delete).Methods("DELETE")
@@ -242,7 +410,16 @@ func main() {
 	// probe
 	router.HandleFunc("/health", probe.Health).Methods("GET")
 	router.HandleFunc("/liveness", probe.Liveness).Methods("GET")
+	if *readinessDB {
+		probe.InitReadiness("db", db.Ping, *readinessDBTimeout, *readinessDBThreshold)
+	}
 	router.HandleFunc("/readiness", probe.Readiness).Methods("GET")
+	// the status reported by grpc.health.v1.Health, e.g. to drain the gRPC services
+	health := g.NewHealthServer()
+	router.Handle("/grpc/health", health).Methods("GET")
+	if *grpcHealthAdmin {
+		router.Handle("/grpc/health", health).Methods("PUT")
+	}
 	router.HandleFunc("/ping-backend", func(w http.ResponseWriter, r *http.Request) {
 		probe.PingBackend(w, r, *backend)
 	}).Methods("GET")
@@ -255,11 +432,31 @@ func main() {
 	}).Methods("GET")
 
 	// dump
-	router.HandleFunc("/dump/", dump.GetAll).Methods("GET")
-	router.HandleFunc("/dump/{name}", dump.GetObj).Methods("GET")
+	if !*dumpDisable {
+		if err := dump.Init(*dumpDir, *dumpMaxSize); err != nil {
+			log.Fatalf("Invalid dump directory: %v", err)
+		}
+		if *collectKinds != "" {
+			collectOpts.Kinds = strings.Split(*collectKinds, ",")
+			c, err := dump.NewCollector(collectOpts)
+			if err != nil {
+				log.Fatalf("Invalid collector options: %v", err)
+			}
+			go c.Run(context.Background())
+		}
+		router.HandleFunc("/dump/", dump.GetAll).Methods("GET")
+		router.HandleFunc("/dump/search", dump.Search).Methods("GET")
+		router.HandleFunc("/dump/diff", dump.Diff).Methods("GET")
+		router.HandleFunc("/dump/archive", dump.Archive).Methods("GET")
+		router.HandleFunc("/dump/{path:.*}", dump.GetObj).Methods("GET")
+		if *dumpUpload {
+			dump.InitUpload(*dumpMaxTotalSize, *dumpMaxFiles)
+			router.HandleFunc("/dump/{path:.*}", dump.Upload).Methods("POST")
+		}
+	}
 
 	// log.Fatal(http.ListenAndServe(":"+port, router))
-	errs := runServer(router, *httpPort, *httpsPort, *grpcPort, *zpagesPort, *cert, *key)
+	errs := runServer(router, store, health, *httpPort, *httpsPort, *grpcPort, *zpagesPort, *cert, *key)
 
 	// This will run forever until channel receives error
 	select {
@@ -0,0 +1,360 @@
+package db
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxSeedCount      = 100000
+	maxImportSize     = 64 << 20
+	maxImportErrors   = 100
+	csvContentType    = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+)
+
+var (
+	csvColumns = []string{"id", "firstname", "lastname", "city", "state"}
+
+	seedFirstnames = []string{"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda",
+		"William", "Elizabeth", "David", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah",
+		"Charles", "Karen", "Wei", "Aiko", "Mateo", "Sofia", "Arjun", "Priya", "Liam", "Olivia", "Noah", "Emma"}
+	seedLastnames = []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+		"Rodriguez", "Martinez", "Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas", "Taylor",
+		"Moore", "Jackson", "Martin", "Lee", "Nguyen", "Chen", "Tanaka", "Patel", "Kim", "Singh", "Doe"}
+	seedCities = []Address{
+		{City: "New York", State: "NY"}, {City: "Los Angeles", State: "CA"}, {City: "San Francisco", State: "CA"},
+		{City: "Chicago", State: "IL"}, {City: "Houston", State: "TX"}, {City: "Austin", State: "TX"},
+		{City: "Phoenix", State: "AZ"}, {City: "Philadelphia", State: "PA"}, {City: "Seattle", State: "WA"},
+		{City: "Denver", State: "CO"}, {City: "Boston", State: "MA"}, {City: "Miami", State: "FL"},
+		{City: "Atlanta", State: "GA"}, {City: "Portland", State: "OR"}, {City: "Nashville", State: "TN"},
+	}
+)
+
+// nextID returns the id following the largest numeric id in the store, the
+// store sorts the ids so only the top of the list is fetched
+func nextID() (int64, error) {
+	// ids which are not numbers may come first, the handlers only take
+	// numbers so they are not expected to fill a whole page
+	people, _, err := store.List(Query{Sort: "id", Desc: true, Limit: maxLimit})
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range people {
+		if n, err := strconv.ParseInt(p.ID, 10, 64); err == nil {
+			return n + 1, nil
+		}
+	}
+	return 1, nil
+}
+
+// Seed generates fake person objects
+// example: curl -X POST 'http://backend:8000/db/seed?count=1000'
+func Seed(w http.ResponseWriter, r *http.Request) {
+	count := 100
+	if s := r.URL.Query().Get("count"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSeedCount {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("count must be between 1 and %d", maxSeedCount))
+			return
+		}
+		count = n
+	}
+
+	first, err := nextID()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	// the ids are not reserved, an id taken meanwhile (by a concurrent
+	// create or seed) is skipped so every person object gets created
+	s := writer(w, r)
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	id, firstCreated, last := first, int64(0), int64(0)
+	created, skipped := 0, 0
+	for created < count {
+		a := seedCities[rnd.Intn(len(seedCities))]
+		p := Person{
+			ID:        strconv.FormatInt(id, 10),
+			Firstname: seedFirstnames[rnd.Intn(len(seedFirstnames))],
+			Lastname:  seedLastnames[rnd.Intn(len(seedLastnames))],
+			Address:   &a,
+		}
+		id++
+		err := s.Create(p)
+		if err == ErrExists {
+			skipped++
+			continue
+		}
+		if err != nil {
+			log.Printf("Seed : ERROR : %s\n", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+				"status":  http.StatusInternalServerError,
+				"error":   err.Error(),
+				"created": created,
+			})
+			return
+		}
+		if created == 0 {
+			firstCreated = id - 1
+		}
+		created++
+		last = id - 1
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"created":  created,
+		"skipped":  skipped,
+		"first_id": strconv.FormatInt(firstCreated, 10),
+		"last_id":  strconv.FormatInt(last, 10),
+	})
+}
+
+// bulkFormat returns the format (csv or ndjson) asked for by the format
+// parameter or by the given header, the parameter is read from the url only
+// as the body of an import must not be parsed as a form
+func bulkFormat(r *http.Request, header string) (string, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		if f != "csv" && f != "ndjson" {
+			return "", fmt.Errorf("unsupported format %q, use csv or ndjson", f)
+		}
+		return f, nil
+	}
+	for _, v := range strings.Split(r.Header.Get(header), ",") {
+		if t, _, err := mime.ParseMediaType(strings.TrimSpace(v)); err == nil && t == csvContentType {
+			return "csv", nil
+		}
+	}
+	return "ndjson", nil
+}
+
+// importError reports a record which could not be imported
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// importReport is the outcome of an import, status and error are set when
+// the body could not be read to the end
+type importReport struct {
+	Status  int           `json:"status,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Failed  int           `json:"failed"`
+	Errors  []importError `json:"errors,omitempty"`
+
+	// store the records are saved to
+	store Store
+}
+
+func (rep *importReport) fail(line int, err error) {
+	rep.Failed++
+	if len(rep.Errors) < maxImportErrors {
+		rep.Errors = append(rep.Errors, importError{Line: line, Error: err.Error()})
+	}
+}
+
+// save validates and stores p, an existing person is only replaced if upsert is set
+func (rep *importReport) save(line int, p Person, upsert bool) {
+	if err := p.Validate(); err != nil {
+		rep.fail(line, err)
+		return
+	}
+
+	err := rep.store.Create(p)
+	if err == ErrExists && upsert {
+		if _, err = rep.store.Update(p, 0); err == nil {
+			rep.Updated++
+			return
+		}
+	}
+	if err != nil {
+		rep.fail(line, err)
+		return
+	}
+	rep.Created++
+}
+
+// Import person objects from NDJSON (one object per line) or CSV (with the
+// columns id,firstname,lastname,city,state, the header row is optional),
+// existing person objects are replaced if upsert=true. The import stops at
+// the first error reading the body (e.g. larger than 64MB), the records read
+// before are kept and reported
+// example: curl --data-binary @people.csv -H "Content-Type: text/csv" -X POST 'http://backend:8000/db/import?upsert=true'
+func Import(w http.ResponseWriter, r *http.Request) {
+	format, err := bulkFormat(r, "Content-Type")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	upsert, _ := strconv.ParseBool(r.URL.Query().Get("upsert"))
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	rep := &importReport{store: writer(w, r)}
+	if format == "csv" {
+		err = importCSV(body, rep, upsert)
+	} else {
+		err = importNDJSON(body, rep, upsert)
+	}
+	if err != nil {
+		// the records read so far are stored, report them along with the error
+		rep.Status = http.StatusBadRequest
+		if _, ok := err.(*http.MaxBytesError); ok {
+			rep.Status = http.StatusRequestEntityTooLarge
+		}
+		rep.Error = fmt.Sprintf("invalid request body: %s", err)
+		writeJSON(w, rep.Status, rep)
+		return
+	}
+
+	status := http.StatusOK
+	if rep.Created > 0 {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, rep)
+}
+
+func importNDJSON(body io.Reader, rep *importReport, upsert bool) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		b := scanner.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		var p Person
+		if err := json.Unmarshal(b, &p); err != nil {
+			rep.fail(line, err)
+			continue
+		}
+		rep.save(line, p, upsert)
+	}
+	return scanner.Err()
+}
+
+func importCSV(body io.Reader, rep *importReport, upsert bool) error {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+
+	// column positions, the header row may reorder or omit columns
+	columns := map[string]int{}
+	for i, c := range csvColumns {
+		columns[c] = i
+	}
+
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		line++
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				rep.fail(line, err)
+				continue
+			}
+			return err
+		}
+
+		if line == 1 && len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), "id") {
+			columns = map[string]int{}
+			for i, c := range record {
+				columns[strings.ToLower(strings.TrimSpace(c))] = i
+			}
+			continue
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		p := Person{ID: field("id"), Firstname: field("firstname"), Lastname: field("lastname")}
+		if city, state := field("city"), field("state"); city != "" || state != "" {
+			p.Address = &Address{City: city, State: state}
+		}
+		rep.save(line, p, upsert)
+	}
+}
+
+// Export streams every person object as NDJSON or CSV (format=csv or Accept: text/csv)
+// example: curl 'http://backend:8000/db/export?format=csv'
+func Export(w http.ResponseWriter, r *http.Request) {
+	format, err := bulkFormat(r, "Accept")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// fetch the first page before writing anything so a failing store
+	// still gets a proper error response
+	q := Query{Limit: maxLimit}
+	page, _, err := store.List(q)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	var write func(p Person) error
+	var flush func()
+	if format == "csv" {
+		w.Header().Set("Content-Type", csvContentType)
+		cw := csv.NewWriter(w)
+		cw.Write(csvColumns)
+		write = func(p Person) error {
+			var city, state string
+			if p.Address != nil {
+				city, state = p.Address.City, p.Address.State
+			}
+			return cw.Write([]string{p.ID, p.Firstname, p.Lastname, city, state})
+		}
+		flush = cw.Flush
+	} else {
+		w.Header().Set("Content-Type", ndjsonContentType)
+		enc := json.NewEncoder(w)
+		write = func(p Person) error { return enc.Encode(p) }
+		flush = func() {}
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=people."+format)
+	w.WriteHeader(http.StatusOK)
+
+	for len(page) > 0 {
+		for _, p := range page {
+			if err := write(p); err != nil {
+				// the client went away
+				return
+			}
+		}
+		flush()
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if len(page) < q.Limit {
+			return
+		}
+
+		q.Offset += len(page)
+		page, _, err = store.List(q)
+		if err != nil {
+			// too late to change the status, abort the stream instead
+			log.Printf("RunQuery : ERROR : %s\n", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSeed(t *testing.T) {
+	s := &MemoryStore{people: map[string]Person{}}
+	for _, id := range []string{"5", "10"} {
+		if err := s.Create(testPerson(id, "Ada", "Lovelace", "London", "LDN")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := testRouter(s)
+
+	var rep struct {
+		Created int    `json:"created"`
+		Skipped int    `json:"skipped"`
+		FirstID string `json:"first_id"`
+		LastID  string `json:"last_id"`
+	}
+	w := serve(router, "POST", "/db/seed?count=20", "")
+	if err := json.NewDecoder(w.Body).Decode(&rep); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("seed: got %d, %v", w.Code, err)
+	}
+	// the ids follow the largest one, which is 10 and not 5
+	if rep.Created != 20 || rep.Skipped != 0 || rep.FirstID != "11" || rep.LastID != "30" {
+		t.Fatalf("seed: got %+v", rep)
+	}
+	if _, total, _ := s.List(Query{}); total != 22 {
+		t.Fatalf("seed: got %d people, want 22", total)
+	}
+	if p, err := s.Get("30"); err != nil || p.Firstname == "" || p.Address == nil {
+		t.Fatalf("seeded person: got %+v, %v", p, err)
+	}
+
+	w = serve(router, "POST", "/db/seed?count=1", "")
+	if err := json.NewDecoder(w.Body).Decode(&rep); err != nil || rep.FirstID != "31" {
+		t.Fatalf("second seed: got %+v, %v", rep, err)
+	}
+
+	for _, count := range []string{"0", "-1", "x", fmt.Sprint(maxSeedCount + 1)} {
+		if w := serve(router, "POST", "/db/seed?count="+count, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("count=%s: got status %d, want 400", count, w.Code)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		body    string
+		status  int
+		created int
+		updated int
+		failed  int
+	}{
+		{
+			name:    "ndjson",
+			url:     "/db/import",
+			body:    `{"id":"1","firstname":"Ada"}` + "\n\n" + `{"id":"2","lastname":"Hopper","address":{"city":"New York"}}` + "\n",
+			status:  http.StatusCreated,
+			created: 2,
+		},
+		{
+			name:    "ndjson failures",
+			url:     "/db/import",
+			body:    `{"id":"1","firstname":"Ada"}` + "\n" + `{"id":"x","firstname":"Bad"}` + "\n" + `{"id":"3"}` + "\n" + `not json` + "\n",
+			status:  http.StatusOK,
+			failed:  4,
+			created: 0,
+		},
+		{
+			name:    "ndjson upsert",
+			url:     "/db/import?upsert=true",
+			body:    `{"id":"1","firstname":"Ada","lastname":"King"}` + "\n" + `{"id":"3","firstname":"Alan"}` + "\n",
+			status:  http.StatusCreated,
+			created: 1,
+			updated: 1,
+		},
+		{
+			name:    "csv with header",
+			url:     "/db/import?format=csv",
+			body:    "id,lastname,firstname\n4,Shannon,Claude\n5,Liskov,Barbara\n",
+			status:  http.StatusCreated,
+			created: 2,
+		},
+		{
+			name:    "csv without header",
+			url:     "/db/import?format=csv",
+			body:    "6,Edsger,Dijkstra,Austin,TX\n7,,,,\n",
+			status:  http.StatusCreated,
+			created: 1,
+			failed:  1,
+		},
+	}
+
+	s := &MemoryStore{people: map[string]Person{}}
+	router := testRouter(s)
+	for _, tt := range tests {
+		w := serve(router, "POST", tt.url, tt.body)
+		var rep importReport
+		if err := json.NewDecoder(w.Body).Decode(&rep); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if w.Code != tt.status || rep.Created != tt.created || rep.Updated != tt.updated || rep.Failed != tt.failed {
+			t.Errorf("%s: got %d %+v, want %d created %d updated %d failed %d",
+				tt.name, w.Code, rep, tt.status, tt.created, tt.updated, tt.failed)
+		}
+		if len(rep.Errors) != rep.Failed {
+			t.Errorf("%s: got %d errors for %d failures", tt.name, len(rep.Errors), rep.Failed)
+		}
+	}
+
+	// the csv columns follow the header
+	if p, _ := s.Get("4"); p.Firstname != "Claude" || p.Lastname != "Shannon" || p.Address != nil {
+		t.Errorf("csv with header: got %+v", p)
+	}
+	if p, _ := s.Get("6"); p.Address == nil || p.Address.City != "Austin" {
+		t.Errorf("csv without header: got %+v", p)
+	}
+	if p, _ := s.Get("1"); p.Lastname != "King" {
+		t.Errorf("upsert: got %+v", p)
+	}
+
+	if w := serve(router, "POST", "/db/import?format=xml", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported format: got status %d", w.Code)
+	}
+}
+
+func TestImportPartial(t *testing.T) {
+	s := &MemoryStore{people: map[string]Person{}}
+	router := testRouter(s)
+
+	// the scanner gives up on a line longer than 1MB, the records before
+	// it are stored and reported
+	body := `{"id":"1","firstname":"Ada"}` + "\n" + `{"id":"2","firstname":"Grace"}` + "\n" +
+		`{"id":"3","firstname":"` + strings.Repeat("x", 2<<20) + `"}` + "\n"
+	w := serve(router, "POST", "/db/import", body)
+	var rep importReport
+	if err := json.NewDecoder(w.Body).Decode(&rep); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusBadRequest || rep.Status != http.StatusBadRequest || rep.Error == "" || rep.Created != 2 {
+		t.Fatalf("got %d %+v", w.Code, rep)
+	}
+	if _, total, _ := s.List(Query{}); total != 2 {
+		t.Fatalf("got %d people, want 2", total)
+	}
+}
+
+func TestExport(t *testing.T) {
+	// more than a page of the store
+	const count = maxLimit + 10
+	s := &MemoryStore{people: map[string]Person{}}
+	for i := 1; i <= count; i++ {
+		p := testPerson(fmt.Sprint(i), "John", fmt.Sprint("Doe", i), "X", "Y")
+		if i%2 == 0 {
+			p.Address = nil
+		}
+		if err := s.Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := testRouter(s)
+
+	w := serve(router, "GET", "/db/export", "")
+	if got := w.Header().Get("Content-Type"); w.Code != http.StatusOK || got != ndjsonContentType {
+		t.Fatalf("ndjson: got %d, Content-Type %q", w.Code, got)
+	}
+	scanner := bufio.NewScanner(w.Body)
+	n := 0
+	for ; scanner.Scan(); n++ {
+		var p Person
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprint(n + 1); p.ID != want || p.Lastname != "Doe"+want {
+			t.Fatalf("ndjson line %d: got %+v", n+1, p)
+		}
+	}
+	if n != count {
+		t.Fatalf("ndjson: got %d lines, want %d", n, count)
+	}
+
+	w = serve(router, "GET", "/db/export?format=csv", "")
+	if got := w.Header().Get("Content-Type"); got != csvContentType {
+		t.Fatalf("csv: got Content-Type %q", got)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != count+1 || strings.Join(records[0], ",") != "id,firstname,lastname,city,state" {
+		t.Fatalf("csv: got %d records, header %v", len(records), records[0])
+	}
+	if got := strings.Join(records[1], ","); got != "1,John,Doe1,X,Y" {
+		t.Fatalf("csv: got first record %q", got)
+	}
+	if got := strings.Join(records[2], ","); got != "2,John,Doe2,," {
+		t.Fatalf("csv: got second record %q", got)
+	}
+
+	// an export can be imported again
+	export := serve(router, "GET", "/db/export?format=csv", "").Body.String()
+	s2 := &MemoryStore{people: map[string]Person{}}
+	w = serve(testRouter(s2), "POST", "/db/import?format=csv", export)
+	if _, total, _ := s2.List(Query{}); w.Code != http.StatusCreated || total != count {
+		t.Fatalf("import of the export: got %d, %d people", w.Code, total)
+	}
+}
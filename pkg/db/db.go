@@ -2,12 +2,15 @@ package db
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
-	mgo "gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
 )
 
 // Person type
@@ -16,6 +19,8 @@ type Person struct {
 	Firstname string   `json:"firstname,omitempty" bson:"firstname"`
 	Lastname  string   `json:"lastname,omitempty" bson:"lastname"`
 	Address   *Address `json:"address,omitempty" bson:"address"`
+	// Version is bumped by the store on every update
+	Version int64 `json:"version,omitempty" bson:"version"`
 }
 
 // Address type
@@ -24,169 +29,375 @@ type Address struct {
 	State string `json:"state,omitempty" bson:"state"`
 }
 
-var db []Person
-var mongoSession *mgo.Session
+// Store is the storage backend behind the /db handlers
+type Store interface {
+	List(q Query) ([]Person, int, error)
+	Get(id string) (Person, error)
+	// Create stores p as version 1
+	Create(p Person) error
+	// Update replaces the stored person and bumps its version, a non zero
+	// version must match the stored one or ErrConflict is returned
+	Update(p Person, version int64) (Person, error)
+	// Delete removes the stored person, a non zero version must match the
+	// stored one or ErrConflict is returned
+	Delete(id string, version int64) error
+}
 
-// Init ...
-func Init(session *mgo.Session) {
-	if session != nil {
-		mongoSession = session
-	} else {
-		db = append(db, Person{ID: "1", Firstname: "John", Lastname: "Doe", Address: &Address{City: "City X", State: "State X"}})
-		// db = append(db, Person{ID: "2", Firstname: "Koko", Lastname: "Doe", Address: &Address{City: "City Z", State: "State Y"}})
+var (
+	// ErrNotFound is returned by a Store when no person matches the given id
+	ErrNotFound = errors.New("person not found")
+	// ErrExists is returned by a Store when a person with the same id already exists
+	ErrExists = errors.New("person already exists")
+	// ErrConflict is returned by a Store when the version of a person does not match
+	ErrConflict = errors.New("person has been modified")
+)
+
+const maxFieldLength = 255
+
+var idPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// Validate checks a person object before it is stored
+func (p *Person) Validate() error {
+	if !idPattern.MatchString(p.ID) {
+		return fmt.Errorf("id %q is not numeric", p.ID)
+	}
+	if p.Firstname == "" && p.Lastname == "" {
+		return errors.New("firstname or lastname is required")
 	}
+	fields := map[string]string{"firstname": p.Firstname, "lastname": p.Lastname}
+	if p.Address != nil {
+		fields["address.city"] = p.Address.City
+		fields["address.state"] = p.Address.State
+	}
+	for name, v := range fields {
+		if len(v) > maxFieldLength {
+			return fmt.Errorf("%s is longer than %d characters", name, maxFieldLength)
+		}
+	}
+	return nil
 }
 
-func getCollection() (*mgo.Collection, *mgo.Session) {
-	s := mongoSession.Copy()
-	c := s.DB("test").C("people")
+// cacheGetter is implemented by stores which can tell whether a person
+// object was served from cache
+type cacheGetter interface {
+	GetCached(id string) (Person, bool, error)
+}
 
-	return c, s
+// recorder is implemented by the stores wrapping another Store to record
+// the changes made through it (e.g. publish them to the watchers)
+type recorder interface {
+	unrecorded() Store
 }
 
-// GetAll person objects
-func GetAll(w http.ResponseWriter, r *http.Request) {
+// unrecorded returns a Store making the changes to s without recording them
+// (e.g. the records of the load generator), s if it records nothing
+func unrecorded(s Store) Store {
+	if r, ok := s.(recorder); ok {
+		return r.unrecorded()
+	}
+	return s
+}
+
+var store Store
+
+// Init sets the store used by the handlers
+func Init(s Store) {
+	store = s
+}
+
+// errorResponse is the body of every non 2xx response
+type errorResponse struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
 
-	if mongoSession != nil {
-		// get all person from mongodb
-		c, s := getCollection()
-		defer s.Close()
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Status: status, Error: msg})
+}
 
-		result := []Person{}
-		err := c.Find(nil).All(&result)
-		if err != nil {
-			log.Printf("RunQuery : ERROR : %s\n", err)
-			return
-		}
+// writeStoreError maps the errors returned by a Store to a response
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrNotFound, ErrNoHistory:
+		writeError(w, http.StatusNotFound, err.Error())
+	case ErrExists:
+		writeError(w, http.StatusConflict, err.Error())
+	case ErrConflict:
+		writeError(w, http.StatusPreconditionFailed, err.Error())
+	default:
+		log.Printf("RunQuery : ERROR : %s\n", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
 
-		json.NewEncoder(w).Encode(result)
+// decodePerson reads the person object in the request body, the id is taken from the url
+func decodePerson(w http.ResponseWriter, r *http.Request) (Person, bool) {
+	id := mux.Vars(r)["id"]
 
-	} else {
-		json.NewEncoder(w).Encode(db)
+	var p Person
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err))
+		return p, false
+	}
+	if p.ID != "" && p.ID != id {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("id %q in body does not match id %q in url", p.ID, id))
+		return p, false
 	}
+	p.ID = id
+	if err := p.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return p, false
+	}
+	// the version is managed by the store
+	p.Version = 0
+	return p, true
 }
 
-// Get a person object
-func Get(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	params := mux.Vars(r)
+// page is the body returned by GetAll when a page is requested
+type page struct {
+	Total      int      `json:"total"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+	People     []Person `json:"people"`
+}
 
-	if mongoSession != nil {
-		// find the person from mongodb
-		c, s := getCollection()
-		defer s.Close()
+// etag returns the entity tag of a person object
+func etag(p Person) string {
+	return `"` + strconv.FormatInt(p.Version, 10) + `"`
+}
 
-		p := Person{}
-		err := c.Find(bson.M{"id": params["id"]}).One(&p)
-		if err != nil {
-			log.Printf("RunQuery : ERROR : %s\n", err)
-			return
+// entityTags splits an If-Match or If-None-Match header into its tags, a
+// weak tag keeps its W/ prefix
+func entityTags(header string) ([]string, error) {
+	var tags []string
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
 		}
-		json.NewEncoder(w).Encode(p)
+		v := strings.TrimPrefix(t, "W/")
+		if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+			return nil, fmt.Errorf("invalid entity tag %q", t)
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
 
-	} else {
-		// find the person from the db slice
-		for _, p := range db {
-			if p.ID == params["id"] {
-				json.NewEncoder(w).Encode(p)
-				return
-			}
+// ifMatch returns the versions listed by the If-Match header, nil if any
+// version will do. The tags are compared the strong way, a weak tag never
+// matches, ErrConflict is returned when no tag can match
+func ifMatch(r *http.Request) ([]int64, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return nil, nil
+	}
+	tags, err := entityTags(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid If-Match header: %s", err)
+	}
+	var versions []int64
+	for _, t := range tags {
+		if strings.HasPrefix(t, "W/") {
+			continue
 		}
+		// a tag which was never handed out can't match
+		if n, err := strconv.ParseInt(t[1:len(t)-1], 10, 64); err == nil && n > 0 {
+			versions = append(versions, n)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, ErrConflict
 	}
+	return versions, nil
 }
 
-// Create a person object
-// example: curl -d '{"id":"100", "firstname":"foo", "lastname":"bar"}' -H "Content-Type: application/json" -X POST http://backend:8000/db/100
-func Create(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	var p Person
-	_ = json.NewDecoder(r.Body).Decode(&p)
-	p.ID = params["id"]
+// readIfMatch returns the version to pass to the store, 0 if any will do, it
+// writes the error response if the If-Match header can't be used or matched
+func readIfMatch(w http.ResponseWriter, r *http.Request, id string) (int64, bool) {
+	versions, err := ifMatch(r)
+	if err == ErrConflict {
+		writeStoreError(w, err)
+		return 0, false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return 0, false
+	}
+	switch len(versions) {
+	case 0:
+		return 0, true
+	case 1:
+		return versions[0], true
+	}
 
-	if mongoSession != nil {
-		c, s := getCollection()
-		defer s.Close()
+	// the store takes a single version, the current one if it is listed
+	// (the store still fails if it changes in between)
+	cur, err := store.Get(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return 0, false
+	}
+	for _, v := range versions {
+		if v == cur.Version {
+			return v, true
+		}
+	}
+	writeStoreError(w, ErrConflict)
+	return 0, false
+}
 
-		err := c.Insert(p)
-		if err != nil {
-			log.Printf("RunQuery : ERROR : %s\n", err)
-			return
+// ifNoneMatch tells whether the If-None-Match header matches p, the tags
+// are compared the weak way
+func ifNoneMatch(r *http.Request, p Person) bool {
+	v := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if v == "*" {
+		return true
+	}
+	// an invalid header is ignored, the object is then sent
+	tags, _ := entityTags(v)
+	for _, t := range tags {
+		if strings.TrimPrefix(t, "W/") == etag(p) {
+			return true
 		}
+	}
+	return false
+}
 
-		GetAll(w, r)
-	} else {
-		db = append(db, p)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(db)
+// GetAll person objects
+// the total number of matches is returned in the X-Total-Count header, and
+// the cursor to the next page (if any) in the X-Next-Cursor and Link headers.
+// When a page is requested (limit, offset or cursor) both are also returned
+// in the body, which is then a page object instead of an array
+// example: curl 'http://backend:8000/db?lastname=Doe&sort=-firstname&limit=10'
+func GetAll(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, total, err := store.List(q)
+	if err != nil {
+		writeStoreError(w, err)
+		return
 	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	var cursor string
+	if next := q.Offset + len(result); q.Limit > 0 && next < total {
+		cursor = encodeCursor(next)
+		v := r.URL.Query()
+		v.Del("offset")
+		v.Set("cursor", cursor)
+		w.Header().Set("X-Next-Cursor", cursor)
+		w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, v.Encode()))
+	}
+	if q.paged {
+		writeJSON(w, http.StatusOK, page{Total: total, NextCursor: cursor, People: result})
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
 }
 
-// Delete a person object
-// example: curl -X DELETE http://backend:8000/db/100
-func Delete(w http.ResponseWriter, r *http.Request) {
+// Get a person object, or with at=<time> the person object as it was at that time
+// example: curl 'http://backend:8000/db/1?at=2019-10-01T12:00:00Z'
+func Get(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
+	if at := r.URL.Query().Get("at"); at != "" {
+		getAt(w, r, at)
+		return
+	}
 
-	if mongoSession != nil {
-		c, s := getCollection()
-		defer s.Close()
-
-		err := c.Remove(bson.M{"id": params["id"]})
-		if err != nil {
-			log.Printf("RunQuery : ERROR : %s\n", err)
-			return
+	var p Person
+	var err error
+	if c, ok := store.(cacheGetter); ok {
+		var hit bool
+		p, hit, err = c.GetCached(params["id"])
+		if hit {
+			w.Header().Set("X-Cache", "HIT")
+		} else {
+			w.Header().Set("X-Cache", "MISS")
 		}
-
-		GetAll(w, r)
 	} else {
-		w.Header().Set("Content-Type", "application/json")
-		for i, p := range db {
-			if p.ID == params["id"] {
-				db = append(db[:i], db[i+1:]...)
-				break
-			}
-			json.NewEncoder(w).Encode(db)
-		}
+		p, err = store.Get(params["id"])
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
 	}
+
+	w.Header().Set("ETag", etag(p))
+	if ifNoneMatch(r, p) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
 }
 
-// Update a person object
-// example: curl -d '{"lastname":"brad"}' -X PUT http://backend:8000/db/100
-func Update(w http.ResponseWriter, r *http.Request) {
+// Create a person object
+// example: curl -d '{"id":"100", "firstname":"foo", "lastname":"bar"}' -H "Content-Type: application/json" -X POST http://backend:8000/db/100
+func Create(w http.ResponseWriter, r *http.Request) {
+	p, ok := decodePerson(w, r)
+	if !ok {
+		return
+	}
+
+	if err := writer(w, r).Create(p); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	p.Version = 1
+
+	w.Header().Set("Location", "/db/"+p.ID)
+	w.Header().Set("ETag", etag(p))
+	writeJSON(w, http.StatusCreated, p)
+}
+
+// Delete a person object, only if it still matches the If-Match header (if any)
+// example: curl -H 'If-Match: "2"' -X DELETE http://backend:8000/db/100
+func Delete(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	var p Person
-	_ = json.NewDecoder(r.Body).Decode(&p)
-	p.ID = params["id"]
+	version, ok := readIfMatch(w, r, params["id"])
+	if !ok {
+		return
+	}
 
-	if mongoSession != nil {
-		c, s := getCollection()
-		defer s.Close()
+	if err := writer(w, r).Delete(params["id"], version); err != nil {
+		writeStoreError(w, err)
+		return
+	}
 
-		err := c.Update(bson.M{"id": params["id"]}, &p)
-		if err != nil {
-			log.Printf("RunQuery : ERROR : %s\n", err)
-			return
-		}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-		GetAll(w, r)
-	} else {
-		// remove the matched person from the slice
-		for i, p := range db {
-			if p.ID == params["id"] {
-				// this approach is supposed to be memory leak free when
-				// the element of the slice is a pointer or a struct with pointer fields.
-				// since the slice here is non of that, we don't have to use this, but
-				// I am leaving this bit of code here just for reference.
-				// (https://github.com/golang/go/wiki/SliceTricks)
-				copy(db[i:], db[i+1:])
-				db[len(db)-1] = Person{}
-				db = db[:len(db)-1]
-				break
-			}
-		}
-		// add the updated person back into the slice
-		db = append(db, p)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(db)
+// Update a person object, only if it still matches the If-Match header (if any)
+// the body replaces the whole object, the fields left out are cleared
+// example: curl -d '{"firstname":"foo", "lastname":"brad"}' -H 'If-Match: "1"' -X PUT http://backend:8000/db/100
+func Update(w http.ResponseWriter, r *http.Request) {
+	version, ok := readIfMatch(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	p, ok := decodePerson(w, r)
+	if !ok {
+		return
 	}
+
+	p, err := writer(w, r).Update(p, version)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/db/"+p.ID)
+	w.Header().Set("ETag", etag(p))
+	writeJSON(w, http.StatusOK, p)
 }
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// testRouter routes the /db handlers the way main does, backed by s
+func testRouter(s Store) *mux.Router {
+	Init(s)
+	router := mux.NewRouter()
+	router.HandleFunc("/db", GetAll).Methods("GET")
+	router.HandleFunc("/db/info", Info).Methods("GET")
+	router.HandleFunc("/db/load", Load).Methods("POST")
+	router.HandleFunc("/db/seed", Seed).Methods("POST")
+	router.HandleFunc("/db/import", Import).Methods("POST")
+	router.HandleFunc("/db/export", Export).Methods("GET")
+	router.HandleFunc("/db/watch", Watch).Methods("GET")
+	router.HandleFunc("/db/{id:[0-9]+}", Get).Methods("GET")
+	router.HandleFunc("/db/{id:[0-9]+}/history", History).Methods("GET")
+	router.HandleFunc("/db/{id:[0-9]+}", Create).Methods("POST")
+	router.HandleFunc("/db/{id:[0-9]+}", Update).Methods("PUT")
+	router.HandleFunc("/db/{id:[0-9]+}", Delete).Methods("DELETE")
+	return router
+}
+
+func serve(h http.Handler, method string, url string, body string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, url, nil)
+	} else {
+		r = httptest.NewRequest(method, url, strings.NewReader(body))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlers(t *testing.T) {
+	router := testRouter(&MemoryStore{people: map[string]Person{}})
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		status   int
+		location string
+	}{
+		{"get missing", "GET", "/db/101", "", http.StatusNotFound, ""},
+		{"create", "POST", "/db/101", `{"firstname":"Ada","lastname":"Lovelace"}`, http.StatusCreated, "/db/101"},
+		{"create existing", "POST", "/db/101", `{"firstname":"Grace"}`, http.StatusConflict, ""},
+		{"create invalid json", "POST", "/db/102", `{"firstname":`, http.StatusBadRequest, ""},
+		{"create unknown field", "POST", "/db/102", `{"firstname":"Grace","age":85}`, http.StatusBadRequest, ""},
+		{"create without name", "POST", "/db/102", `{"address":{"city":"New York"}}`, http.StatusBadRequest, ""},
+		{"create id mismatch", "POST", "/db/102", `{"id":"103","firstname":"Grace"}`, http.StatusBadRequest, ""},
+		{"create long field", "POST", "/db/102", `{"firstname":"` + strings.Repeat("x", maxFieldLength+1) + `"}`, http.StatusBadRequest, ""},
+		{"get", "GET", "/db/101", "", http.StatusOK, ""},
+		{"update", "PUT", "/db/101", `{"firstname":"Ada","lastname":"King"}`, http.StatusOK, "/db/101"},
+		{"update missing", "PUT", "/db/102", `{"firstname":"Grace"}`, http.StatusNotFound, ""},
+		{"update invalid", "PUT", "/db/101", `{}`, http.StatusBadRequest, ""},
+		{"delete", "DELETE", "/db/101", "", http.StatusNoContent, ""},
+		{"delete missing", "DELETE", "/db/101", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := serve(router, tt.method, tt.url, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d (%s)", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if got := w.Header().Get("Location"); got != tt.location {
+			t.Errorf("%s: got Location %q, want %q", tt.name, got, tt.location)
+		}
+		if w.Code == http.StatusNoContent {
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s: got Content-Type %q", tt.name, got)
+		}
+		// errors carry their status in the body
+		if w.Code >= 400 {
+			var e errorResponse
+			if err := json.NewDecoder(w.Body).Decode(&e); err != nil || e.Status != w.Code || e.Error == "" {
+				t.Errorf("%s: got error body %+v, %v", tt.name, e, err)
+			}
+		}
+	}
+}
+
+func TestHandlersBody(t *testing.T) {
+	router := testRouter(&MemoryStore{people: map[string]Person{}})
+
+	w := serve(router, "POST", "/db/101", `{"firstname":"Ada","lastname":"Lovelace","address":{"city":"London"}}`)
+	var p Person
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	// the id is taken from the url
+	if p.ID != "101" || p.Lastname != "Lovelace" || p.Address == nil || p.Address.City != "London" {
+		t.Fatalf("create: got %+v", p)
+	}
+
+	w = serve(router, "GET", "/db", "")
+	var result []Person
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(result) != 1 || result[0].ID != "101" {
+		t.Fatalf("get all: got %d %+v", w.Code, result)
+	}
+}
+
+func TestVersionHandlers(t *testing.T) {
+	router := testRouter(&MemoryStore{people: map[string]Person{}})
+
+	tests := []struct {
+		name    string
+		method  string
+		header  string
+		value   string
+		body    string
+		status  int
+		etag    string
+		version int64
+	}{
+		{"create", "POST", "", "", `{"firstname":"Ada"}`, http.StatusCreated, `"1"`, 1},
+		{"get", "GET", "", "", "", http.StatusOK, `"1"`, 1},
+		{"get unchanged", "GET", "If-None-Match", `"1"`, "", http.StatusNotModified, `"1"`, 0},
+		{"get unchanged weak", "GET", "If-None-Match", `W/"1"`, "", http.StatusNotModified, `"1"`, 0},
+		{"get unchanged list", "GET", "If-None-Match", `"7", "1"`, "", http.StatusNotModified, `"1"`, 0},
+		{"get changed", "GET", "If-None-Match", `"0"`, "", http.StatusOK, `"1"`, 1},
+		{"update", "PUT", "If-Match", `"1"`, `{"firstname":"Ada","lastname":"King"}`, http.StatusOK, `"2"`, 2},
+		{"update stale", "PUT", "If-Match", `"1"`, `{"firstname":"Grace"}`, http.StatusPreconditionFailed, "", 0},
+		{"update weak", "PUT", "If-Match", `W/"2"`, `{"firstname":"Grace"}`, http.StatusPreconditionFailed, "", 0},
+		{"update unknown tag", "PUT", "If-Match", `"abc"`, `{"firstname":"Grace"}`, http.StatusPreconditionFailed, "", 0},
+		{"update invalid header", "PUT", "If-Match", `2`, `{"firstname":"Grace"}`, http.StatusBadRequest, "", 0},
+		{"update list", "PUT", "If-Match", `"1", W/"3", "2"`, `{"firstname":"Ada","lastname":"Byron"}`, http.StatusOK, `"3"`, 3},
+		{"update list stale", "PUT", "If-Match", `"1", "2"`, `{"firstname":"Grace"}`, http.StatusPreconditionFailed, "", 0},
+		{"update any", "PUT", "If-Match", `*`, `{"firstname":"Ada"}`, http.StatusOK, `"4"`, 4},
+		{"update unconditional", "PUT", "", "", `{"firstname":"Ada"}`, http.StatusOK, `"5"`, 5},
+		{"delete stale", "DELETE", "If-Match", `"4"`, "", http.StatusPreconditionFailed, "", 0},
+		{"delete", "DELETE", "If-Match", `"5"`, "", http.StatusNoContent, "", 0},
+	}
+	for _, tt := range tests {
+		var r *http.Request
+		if tt.body == "" {
+			r = httptest.NewRequest(tt.method, "/db/101", nil)
+		} else {
+			r = httptest.NewRequest(tt.method, "/db/101", strings.NewReader(tt.body))
+		}
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d (%s)", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if got := w.Header().Get("ETag"); got != tt.etag {
+			t.Errorf("%s: got ETag %q, want %q", tt.name, got, tt.etag)
+		}
+		if tt.version != 0 {
+			var p Person
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil || p.Version != tt.version {
+				t.Errorf("%s: got %+v, %v, want version %d", tt.name, p, err, tt.version)
+			}
+		}
+	}
+}
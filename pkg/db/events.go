@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	eventBuffer       = 64
+	eventKeepAlive    = 15 * time.Second
+	eventCreate       = "create"
+	eventUpdate       = "update"
+	eventDelete       = "delete"
+	eventStreamFormat = "event: %s\ndata: %s\n\n"
+)
+
+// ErrWatchUnsupported is returned when the store has no change feed
+var ErrWatchUnsupported = errors.New("store does not support watching changes")
+
+// Event is a change made to a person object
+type Event struct {
+	Type   string    `json:"type"`
+	ID     string    `json:"id,omitempty"`
+	Person *Person   `json:"person,omitempty"`
+	Time   time.Time `json:"time"`
+	// Key is the backend specific key of the object, only set when the id
+	// is not known (e.g. a document deleted before the watch started)
+	Key string `json:"key,omitempty"`
+}
+
+// Watcher is implemented by stores which can stream their changes, the
+// channel is closed when ctx is done or the feed breaks
+type Watcher interface {
+	Watch(ctx context.Context) (<-chan Event, error)
+}
+
+// broadcaster fans the events published in this process out to the watchers
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// Watch implements Watcher
+func (b *broadcaster) Watch(ctx context.Context) (<-chan Event, error) {
+	ch := make(chan Event, eventBuffer)
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = map[chan Event]struct{}{}
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subs, ch)
+		close(ch)
+		b.mu.Unlock()
+	}()
+	return ch, nil
+}
+
+func (b *broadcaster) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// a slow watcher must not block the writes
+			log.Printf("Watch : dropped %s event of person %s\n", e.Type, e.ID)
+		}
+	}
+}
+
+// EventStore publishes the changes made through a Store to its watchers, it
+// is used for stores without a change feed of their own (or whose server
+// can't provide one) so it only sees the changes made by this process
+type EventStore struct {
+	Store
+	broadcaster
+}
+
+// NewEventStore returns an EventStore wrapping s
+func NewEventStore(s Store) *EventStore {
+	return &EventStore{Store: s}
+}
+
+// Create a person object
+func (s *EventStore) Create(p Person) error {
+	if err := s.Store.Create(p); err != nil {
+		return err
+	}
+	p.Version = 1
+	s.publish(Event{Type: eventCreate, ID: p.ID, Person: &p, Time: time.Now()})
+	return nil
+}
+
+// Update a person object
+func (s *EventStore) Update(p Person, version int64) (Person, error) {
+	p, err := s.Store.Update(p, version)
+	if err != nil {
+		return p, err
+	}
+	e := p
+	s.publish(Event{Type: eventUpdate, ID: p.ID, Person: &e, Time: time.Now()})
+	return p, nil
+}
+
+// Delete a person object
+func (s *EventStore) Delete(id string, version int64) error {
+	if err := s.Store.Delete(id, version); err != nil {
+		return err
+	}
+	s.publish(Event{Type: eventDelete, ID: id, Time: time.Now()})
+	return nil
+}
+
+// appendChange forwards the history to the wrapped store
+func (s *EventStore) appendChange(c Change) error {
+	if l, ok := s.Store.(historyLog); ok {
+		return l.appendChange(c)
+	}
+	return ErrHistoryUnsupported
+}
+
+func (s *EventStore) changes(id string) ([]Change, error) {
+	if l, ok := s.Store.(historyLog); ok {
+		return l.changes(id)
+	}
+	return nil, ErrHistoryUnsupported
+}
+
+// unrecorded skips the watchers
+func (s *EventStore) unrecorded() Store {
+	return unrecorded(s.Store)
+}
+
+// Watch streams the changes from the change feed of the wrapped store if it
+// has one, the changes made through this process otherwise
+func (s *EventStore) Watch(ctx context.Context) (<-chan Event, error) {
+	if w, ok := s.Store.(Watcher); ok {
+		ch, err := w.Watch(ctx)
+		if err != ErrWatchUnsupported {
+			return ch, err
+		}
+		log.Printf("Watch : %T has no change feed, only the changes made by this process are watched\n", s.Store)
+	}
+	return s.broadcaster.Watch(ctx)
+}
+
+// Watch streams the changes of person objects as server-sent events
+// example: curl -N http://backend:8000/db/watch
+func Watch(w http.ResponseWriter, r *http.Request) {
+	watcher, ok := store.(Watcher)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, ErrWatchUnsupported.Error())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	events, err := watcher.Watch(ctx)
+	if err == ErrWatchUnsupported {
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// stop nginx style proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, ": watching %T\n\n", store)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				// the feed broke, let the client reconnect
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("Watch : ERROR : %s\n", err)
+				continue
+			}
+			fmt.Fprintf(w, eventStreamFormat, e.Type, data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-ctx.Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
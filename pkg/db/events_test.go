@@ -0,0 +1,146 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event of ch, failing after a second
+func nextEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+func TestEventStore(t *testing.T) {
+	s := NewEventStore(&MemoryStore{people: map[string]Person{}})
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := s.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Create(testPerson("101", "Ada", "Lovelace", "London", "LDN")); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, events); e.Type != eventCreate || e.ID != "101" || e.Person == nil || e.Person.Version != 1 {
+		t.Fatalf("create: got %+v", e)
+	}
+	if _, err := s.Update(testPerson("101", "Ada", "King", "London", "LDN"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, events); e.Type != eventUpdate || e.Person == nil || e.Person.Lastname != "King" || e.Person.Version != 2 {
+		t.Fatalf("update: got %+v", e)
+	}
+
+	// a failed change is not published
+	if _, err := s.Update(testPerson("101", "Ada", "Byron", "London", "LDN"), 1); err != ErrConflict {
+		t.Fatalf("stale update: got %v", err)
+	}
+	// neither are the changes made without recording them
+	if err := unrecorded(s).Create(testPerson("102", "Grace", "Hopper", "New York", "NY")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("101", 0); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, events); e.Type != eventDelete || e.ID != "101" || e.Person != nil {
+		t.Fatalf("delete: got %+v", e)
+	}
+
+	// the feed is closed with the context
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchHandler(t *testing.T) {
+	s := NewEventStore(&MemoryStore{people: map[string]Person{}})
+	Init(s)
+	srv := httptest.NewServer(http.HandlerFunc(Watch))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("got Content-Type %q", got)
+	}
+
+	// the comment line is flushed once the watch started
+	r := bufio.NewReader(resp.Body)
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(line, ": watching") {
+		t.Fatalf("got %q, %v", line, err)
+	}
+	if err := s.Create(testPerson("101", "Ada", "Lovelace", "London", "LDN")); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for len(lines) < 2 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if lines[0] != "event: create" || !strings.HasPrefix(lines[1], "data: ") {
+		t.Fatalf("got %q", lines)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &e); err != nil || e.ID != "101" {
+		t.Fatalf("got %+v, %v", e, err)
+	}
+}
+
+func TestWatchUnsupported(t *testing.T) {
+	router := testRouter(&MemoryStore{people: map[string]Person{}})
+	if w := serve(router, "GET", "/db/watch", ""); w.Code != http.StatusNotImplemented {
+		t.Fatalf("got status %d", w.Code)
+	}
+}
+
+func TestLoadUnrecorded(t *testing.T) {
+	s := NewEventStore(&MemoryStore{people: map[string]Person{}})
+	router := testRouter(s)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := s.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(router, "POST", "/db/load?ops=read:1,write:1,update:1,delete:1&concurrency=2&duration=50ms", "")
+	var rep LoadReport
+	if err := json.NewDecoder(w.Body).Decode(&rep); err != nil || w.Code != http.StatusOK || rep.Total == 0 {
+		t.Fatalf("got %d %+v, %v", w.Code, rep, err)
+	}
+	// the records of the run are cleaned up and never published
+	if _, total, _ := s.List(Query{}); total != 0 {
+		t.Fatalf("got %d people left", total)
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("got event %+v", e)
+	default:
+	}
+
+	if w := serve(router, "GET", "/db/load", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: got status %d", w.Code)
+	}
+}
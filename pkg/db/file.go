@@ -0,0 +1,305 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	fileStoreLog = "people.log"
+	// the history is never compacted
+	fileHistoryLog = "history.log"
+	fileOpPut      = "put"
+	fileOpDelete   = "delete"
+)
+
+// fileRecord is a line of the log of a FileStore
+type fileRecord struct {
+	Op     string    `json:"op"`
+	ID     string    `json:"id"`
+	Person *Person   `json:"person,omitempty"`
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host,omitempty"`
+}
+
+// FileStore keeps person objects in memory and appends every change to a log
+// file, the log is replayed (and compacted) when the store is opened so the
+// person objects survive restarts as long as the directory does (e.g. a
+// PersistentVolume mounted at /data)
+type FileStore struct {
+	mu      sync.Mutex
+	mem     *MemoryStore
+	dir     string
+	file    *os.File
+	history *os.File
+	host    string
+	loaded  int
+	opened  time.Time
+}
+
+// NewFileStore opens the log in dir, creating both if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	s := &FileStore{
+		mem:    &MemoryStore{people: map[string]Person{}},
+		dir:    dir,
+		host:   host,
+		opened: time.Now(),
+	}
+
+	path := filepath.Join(dir, fileStoreLog)
+	n, err := s.replay(path)
+	if err != nil {
+		return nil, err
+	}
+	s.loaded = len(s.mem.people)
+	log.Printf("FileStore : replayed %d records of %s, %d person objects\n", n, path, s.loaded)
+
+	if err := s.compact(path); err != nil {
+		return nil, err
+	}
+	s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	historyPath := filepath.Join(dir, fileHistoryLog)
+	if err := s.replayHistory(historyPath); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	s.history, err = os.OpenFile(historyPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// replayHistory loads the changes recorded in the history log at path
+func (s *FileStore) replayHistory(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		var c Change
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			log.Printf("FileStore : skipping change %d of %s: %s\n", n, path, err)
+			continue
+		}
+		s.mem.appendChange(c)
+	}
+	return scanner.Err()
+}
+
+// replay applies the records of the log at path, it returns the number of records read
+func (s *FileStore) replay(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		var rec fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// most likely the last record was cut short by a crash
+			log.Printf("FileStore : skipping record %d of %s: %s\n", n, path, err)
+			continue
+		}
+		switch rec.Op {
+		case fileOpPut:
+			if rec.Person != nil {
+				s.mem.people[rec.ID] = *rec.Person
+			}
+		case fileOpDelete:
+			delete(s.mem.people, rec.ID)
+		}
+	}
+	return n, scanner.Err()
+}
+
+// compact rewrites the log with a single record per person object
+func (s *FileStore) compact(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	now := time.Now()
+	for id, p := range s.mem.people {
+		p := p
+		if err := enc.Encode(fileRecord{Op: fileOpPut, ID: id, Person: &p, Time: now, Host: s.host}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// append writes rec to the log and syncs it to disk
+func (s *FileStore) append(rec fileRecord) error {
+	rec.Time = time.Now()
+	rec.Host = s.host
+	return writeLine(s.file, rec)
+}
+
+// writeLine writes v as a line of JSON to f and syncs it to disk
+func writeLine(f *os.File, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Close the logs
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history.Close()
+	return s.file.Close()
+}
+
+func (s *FileStore) appendChange(c Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := writeLine(s.history, c); err != nil {
+		return err
+	}
+	return s.mem.appendChange(c)
+}
+
+func (s *FileStore) changes(id string) ([]Change, error) {
+	return s.mem.changes(id)
+}
+
+// List the person objects selected by q
+func (s *FileStore) List(q Query) ([]Person, int, error) {
+	return s.mem.List(q)
+}
+
+// Get a person object
+func (s *FileStore) Get(id string) (Person, error) {
+	return s.mem.Get(id)
+}
+
+// Create a person object
+func (s *FileStore) Create(p Person) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.Create(p); err != nil {
+		return err
+	}
+	p.Version = 1
+	if err := s.append(fileRecord{Op: fileOpPut, ID: p.ID, Person: &p}); err != nil {
+		// keep memory in line with the log
+		s.mem.Delete(p.ID, 0)
+		return err
+	}
+	return nil
+}
+
+// Update a person object
+func (s *FileStore) Update(p Person, version int64) (Person, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, err := s.mem.Get(p.ID)
+	if err != nil {
+		return p, err
+	}
+	p, err = s.mem.Update(p, version)
+	if err != nil {
+		return p, err
+	}
+	if err := s.append(fileRecord{Op: fileOpPut, ID: p.ID, Person: &p}); err != nil {
+		s.mem.mu.Lock()
+		s.mem.people[prev.ID] = prev
+		s.mem.mu.Unlock()
+		return p, err
+	}
+	return p, nil
+}
+
+// Delete a person object
+func (s *FileStore) Delete(id string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, err := s.mem.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.mem.Delete(id, version); err != nil {
+		return err
+	}
+	if err := s.append(fileRecord{Op: fileOpDelete, ID: id}); err != nil {
+		s.mem.mu.Lock()
+		s.mem.people[id] = prev
+		s.mem.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Info reports the log file and how many person objects were restored from it
+func (s *FileStore) Info() (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fi, err := s.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path":     filepath.Join(s.dir, fileStoreLog),
+		"size":     fi.Size(),
+		"restored": s.loaded,
+		"opened":   s.opened,
+		"host":     s.host,
+	}, nil
+}
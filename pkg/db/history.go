@@ -0,0 +1,261 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+var (
+	// ErrHistoryUnsupported is returned when the store does not record the changes
+	ErrHistoryUnsupported = errors.New("store does not record the history of changes")
+	// ErrNoHistory is returned when the changes asked for were made before
+	// the history was recorded
+	ErrNoHistory = errors.New("no history of person")
+)
+
+// Change is a recorded change of a person object
+type Change struct {
+	Type    string `json:"type" bson:"type"`
+	ID      string `json:"id" bson:"id"`
+	Version int64  `json:"version,omitempty" bson:"version"`
+	// Person is the person object after the change, nil on delete
+	Person    *Person   `json:"person,omitempty" bson:"person,omitempty"`
+	Time      time.Time `json:"time" bson:"time"`
+	Host      string    `json:"host,omitempty" bson:"host"`
+	RequestID string    `json:"request_id,omitempty" bson:"request_id"`
+}
+
+// historyLog is implemented by stores which can keep the changes next to the
+// person objects, so every replica sharing the store sees the same history
+type historyLog interface {
+	appendChange(c Change) error
+	// changes returns the changes of a person object, oldest first
+	changes(id string) ([]Change, error)
+}
+
+// originBinder is implemented by stores which record who made a change
+type originBinder interface {
+	withOrigin(requestID string) Store
+}
+
+// HistoryStore records every change made through a Store with the time, the
+// hostname of the pod and the id of the request which made it
+type HistoryStore struct {
+	Store
+	log       historyLog
+	host      string
+	requestID string
+}
+
+// NewHistoryStore returns a HistoryStore keeping the history in s
+func NewHistoryStore(s Store) (*HistoryStore, error) {
+	l, ok := s.(historyLog)
+	if !ok {
+		return nil, ErrHistoryUnsupported
+	}
+	host, _ := os.Hostname()
+	return &HistoryStore{Store: s, log: l, host: host}, nil
+}
+
+// WithOrigin returns a Store recording the changes made through it with the
+// given request id, s is returned as is if it does not record the changes
+func WithOrigin(s Store, requestID string) Store {
+	if b, ok := s.(originBinder); ok {
+		return b.withOrigin(requestID)
+	}
+	return s
+}
+
+// unrecorded skips the history
+func (s *HistoryStore) unrecorded() Store {
+	return unrecorded(s.Store)
+}
+
+func (s *HistoryStore) withOrigin(requestID string) Store {
+	c := *s
+	c.requestID = requestID
+	return &c
+}
+
+// record appends a change, the change itself is already stored so a failure
+// is only logged
+func (s *HistoryStore) record(typ string, id string, version int64, p *Person) {
+	c := Change{Type: typ, ID: id, Version: version, Person: p, Time: time.Now().UTC(), Host: s.host, RequestID: s.requestID}
+	if err := s.log.appendChange(c); err != nil {
+		log.Printf("History : ERROR : failed to record %s of person %s: %s\n", typ, id, err)
+	}
+}
+
+// Create a person object
+func (s *HistoryStore) Create(p Person) error {
+	if err := s.Store.Create(p); err != nil {
+		return err
+	}
+	p.Version = 1
+	s.record(eventCreate, p.ID, p.Version, &p)
+	return nil
+}
+
+// Update a person object
+func (s *HistoryStore) Update(p Person, version int64) (Person, error) {
+	p, err := s.Store.Update(p, version)
+	if err != nil {
+		return p, err
+	}
+	c := p.clone()
+	s.record(eventUpdate, p.ID, p.Version, &c)
+	return p, nil
+}
+
+// Delete a person object
+func (s *HistoryStore) Delete(id string, version int64) error {
+	if err := s.Store.Delete(id, version); err != nil {
+		return err
+	}
+	s.record(eventDelete, id, version, nil)
+	return nil
+}
+
+// History returns the changes of a person object, oldest first. A person
+// object which has not changed since the history is recorded has no history,
+// ErrNoHistory is returned then
+func (s *HistoryStore) History(id string) ([]Change, error) {
+	changes, err := s.log.changes(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		if _, err := s.Store.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoHistory
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Time.Before(changes[j].Time) })
+	return changes, nil
+}
+
+// At returns a person object as it was at t. A person object without history
+// has not changed since before the history is recorded, its current state is
+// returned. ErrNoHistory is returned for a time before the first change
+// recorded unless that change is the creation
+func (s *HistoryStore) At(id string, t time.Time) (Person, error) {
+	changes, err := s.History(id)
+	if err == ErrNoHistory {
+		return s.Store.Get(id)
+	}
+	if err != nil {
+		return Person{}, err
+	}
+	var last *Change
+	for i := range changes {
+		if changes[i].Time.After(t) {
+			break
+		}
+		last = &changes[i]
+	}
+	switch {
+	case last != nil && last.Person != nil:
+		return *last.Person, nil
+	case last != nil, changes[0].Type == eventCreate:
+		// deleted, or not created yet
+		return Person{}, ErrNotFound
+	default:
+		// changed before the history was recorded
+		return Person{}, ErrNoHistory
+	}
+}
+
+// Watch streams the changes of the wrapped store
+func (s *HistoryStore) Watch(ctx context.Context) (<-chan Event, error) {
+	if w, ok := s.Store.(Watcher); ok {
+		return w.Watch(ctx)
+	}
+	return nil, ErrWatchUnsupported
+}
+
+// Info describes the wrapped store
+func (s *HistoryStore) Info() (map[string]interface{}, error) {
+	return backendInfo(s.Store)
+}
+
+// historian is implemented by the stores serving the history of the person objects
+type historian interface {
+	History(id string) ([]Change, error)
+	At(id string, t time.Time) (Person, error)
+}
+
+// requestID returns the id of the request, from the X-Request-Id header if
+// set (e.g. by a load balancer or a mesh), a new one otherwise, the id is
+// sent back in the response
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	w.Header().Set(requestIDHeader, id)
+	return id
+}
+
+// writer returns the store to make the changes asked for by r through
+func writer(w http.ResponseWriter, r *http.Request) Store {
+	return WithOrigin(store, requestID(w, r))
+}
+
+// History of a person object
+// example: curl http://backend:8000/db/1/history
+func History(w http.ResponseWriter, r *http.Request) {
+	h, ok := store.(historian)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, ErrHistoryUnsupported.Error())
+		return
+	}
+	changes, err := h.History(mux.Vars(r)["id"])
+	if err == ErrHistoryUnsupported {
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// getAt writes a person object as it was at the time in the at parameter
+func getAt(w http.ResponseWriter, r *http.Request, at string) {
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid time %q, use RFC 3339 (e.g. 2006-01-02T15:04:05Z)", at))
+		return
+	}
+	h, ok := store.(historian)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, ErrHistoryUnsupported.Error())
+		return
+	}
+	p, err := h.At(mux.Vars(r)["id"], t)
+	if err == ErrHistoryUnsupported {
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(p))
+	writeJSON(w, http.StatusOK, p)
+}
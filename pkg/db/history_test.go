@@ -0,0 +1,173 @@
+package db
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestHistoryStore(t *testing.T, s Store) *HistoryStore {
+	h, err := NewHistoryStore(NewEventStore(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestHistoryStore(t *testing.T) {
+	m := &MemoryStore{people: map[string]Person{}}
+	h := newTestHistoryStore(t, m)
+	s := WithOrigin(h, "req-1")
+
+	if err := s.Create(testPerson("101", "Ada", "Lovelace", "London", "LDN")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Update(testPerson("101", "Ada", "King", "London", "LDN"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Delete("101", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := h.History("101")
+	if err != nil || len(changes) != 3 {
+		t.Fatalf("History: got %+v, %v", changes, err)
+	}
+	for i, want := range []struct {
+		typ       string
+		version   int64
+		requestID string
+	}{
+		{eventCreate, 1, "req-1"},
+		{eventUpdate, 2, "req-1"},
+		{eventDelete, 2, ""},
+	} {
+		c := changes[i]
+		if c.Type != want.typ || c.Version != want.version || c.RequestID != want.requestID || c.Host != h.host {
+			t.Errorf("change %d: got %+v", i, c)
+		}
+	}
+	if changes[2].Person != nil || changes[1].Person == nil || changes[1].Person.Lastname != "King" {
+		t.Errorf("History: got the people %+v, %+v", changes[1].Person, changes[2].Person)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		t        time.Time
+		lastname string
+		err      error
+	}{
+		{"before the create", changes[0].Time.Add(-time.Second), "", ErrNotFound},
+		{"at the create", changes[0].Time, "Lovelace", nil},
+		{"after the update", changes[1].Time, "King", nil},
+		{"after the delete", changes[2].Time.Add(time.Second), "", ErrNotFound},
+	} {
+		p, err := h.At("101", tt.t)
+		if err != tt.err || p.Lastname != tt.lastname {
+			t.Errorf("At %s: got %+v, %v", tt.name, p, err)
+		}
+	}
+
+	if _, err := h.History("404"); err != ErrNotFound {
+		t.Errorf("History of a missing person: got %v, want ErrNotFound", err)
+	}
+
+	// the changes made unrecorded are not in the history
+	if err := unrecorded(h).Create(testPerson("102", "Grace", "Hopper", "New York", "NY")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.History("102"); err != ErrNoHistory {
+		t.Errorf("History of an unrecorded person: got %v, want ErrNoHistory", err)
+	}
+}
+
+func TestHistoryStoreBefore(t *testing.T) {
+	// the person is created before the history is recorded
+	m := &MemoryStore{people: map[string]Person{}}
+	if err := m.Create(testPerson("101", "Ada", "Lovelace", "London", "LDN")); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHistoryStore(t, m)
+
+	if _, err := h.History("101"); err != ErrNoHistory {
+		t.Fatalf("History: got %v, want ErrNoHistory", err)
+	}
+	// without history the person is as it is now
+	if p, err := h.At("101", time.Now().Add(-time.Hour)); err != nil || p.Lastname != "Lovelace" {
+		t.Fatalf("At without history: got %+v, %v", p, err)
+	}
+
+	if _, err := h.Update(testPerson("101", "Ada", "King", "London", "LDN"), 0); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := h.History("101")
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("History: got %+v, %v", changes, err)
+	}
+	// before the first change the person is unknown, but it existed
+	if _, err := h.At("101", changes[0].Time.Add(-time.Second)); err != ErrNoHistory {
+		t.Fatalf("At before the history: got %v, want ErrNoHistory", err)
+	}
+	if p, err := h.At("101", changes[0].Time); err != nil || p.Lastname != "King" {
+		t.Fatalf("At after the update: got %+v, %v", p, err)
+	}
+}
+
+func TestHistoryHandlers(t *testing.T) {
+	router := testRouter(newTestHistoryStore(t, &MemoryStore{people: map[string]Person{}}))
+
+	r := httptest.NewRequest("POST", "/db/101", strings.NewReader(`{"firstname":"Ada","lastname":"Lovelace"}`))
+	r.Header.Set(requestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated || w.Header().Get(requestIDHeader) != "req-1" {
+		t.Fatalf("create: got %d, %s %q", w.Code, requestIDHeader, w.Header().Get(requestIDHeader))
+	}
+	// an id is generated when none is given
+	w = serve(router, "PUT", "/db/101", `{"firstname":"Ada","lastname":"King"}`)
+	if w.Code != http.StatusOK || w.Header().Get(requestIDHeader) == "" {
+		t.Fatalf("update: got %d, %s %q", w.Code, requestIDHeader, w.Header().Get(requestIDHeader))
+	}
+
+	w = serve(router, "GET", "/db/101/history", "")
+	var changes []Change
+	if err := json.NewDecoder(w.Body).Decode(&changes); err != nil || w.Code != http.StatusOK || len(changes) != 2 {
+		t.Fatalf("history: got %d %+v, %v", w.Code, changes, err)
+	}
+	if changes[0].RequestID != "req-1" || changes[1].RequestID == "" {
+		t.Fatalf("history: got the request ids %q, %q", changes[0].RequestID, changes[1].RequestID)
+	}
+
+	at := changes[0].Time.Format(time.RFC3339Nano)
+	w = serve(router, "GET", "/db/101?at="+at, "")
+	var p Person
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil || w.Code != http.StatusOK || p.Lastname != "Lovelace" {
+		t.Fatalf("get at %s: got %d %+v, %v", at, w.Code, p, err)
+	}
+	if got := w.Header().Get("ETag"); got != `"1"` {
+		t.Fatalf("get at %s: got ETag %q", at, got)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{"history of a missing person", "/db/404/history", http.StatusNotFound},
+		{"get before the create", "/db/101?at=2000-01-01T00:00:00Z", http.StatusNotFound},
+		{"get at an invalid time", "/db/101?at=yesterday", http.StatusBadRequest},
+	} {
+		if w := serve(router, "GET", tt.url, ""); w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+
+	// a store without history
+	router = testRouter(&MemoryStore{people: map[string]Person{}})
+	if w := serve(router, "GET", "/db/101/history", ""); w.Code != http.StatusNotImplemented {
+		t.Errorf("history unsupported: got status %d", w.Code)
+	}
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// infoer is implemented by stores which can describe the backend they are connected to
+type infoer interface {
+	Info() (map[string]interface{}, error)
+}
+
+// pinger is implemented by stores which depend on a server being reachable
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// pingCall is a ping of the store in flight
+type pingCall struct {
+	done chan struct{}
+	err  error
+}
+
+var (
+	pingMu sync.Mutex
+	// inflight is the ping in flight, shared by the callers until it returns
+	// so a server which does not answer is not pinged again and again
+	inflight *pingCall
+)
+
+// Ping checks the server behind the store (if any) can be reached before ctx
+// is done, a single ping is in flight at a time
+func Ping(ctx context.Context) error {
+	p, ok := store.(pinger)
+	if !ok {
+		return nil
+	}
+	pingMu.Lock()
+	call := inflight
+	if call == nil {
+		call = &pingCall{done: make(chan struct{})}
+		inflight = call
+		go func() {
+			call.err = p.Ping(ctx)
+			pingMu.Lock()
+			inflight = nil
+			pingMu.Unlock()
+			close(call.done)
+		}()
+	}
+	pingMu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pingBackend pings a wrapped store
+func pingBackend(ctx context.Context, s Store) error {
+	if p, ok := s.(pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Ping the wrapped store
+func (s *EventStore) Ping(ctx context.Context) error {
+	return pingBackend(ctx, s.Store)
+}
+
+// Ping the wrapped store
+func (s *HistoryStore) Ping(ctx context.Context) error {
+	return pingBackend(ctx, s.Store)
+}
+
+// Ping the backing store, an unavailable cache only slows the reads down
+func (s *CachedStore) Ping(ctx context.Context) error {
+	return pingBackend(ctx, s.Store)
+}
+
+// Info reports the store behind the /db handlers, for MongoDB the server
+// version, the current primary and the members of the replica set
+// example: curl http://backend:8000/db/info
+func Info(w http.ResponseWriter, r *http.Request) {
+	out := map[string]interface{}{"store": fmt.Sprintf("%T", store)}
+	if i, ok := store.(infoer); ok {
+		info, err := i.Info()
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		for k, v := range info {
+			out[k] = v
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// Info describes the wrapped store
+func (s *EventStore) Info() (map[string]interface{}, error) {
+	return backendInfo(s.Store)
+}
+
+// Info describes the backing store
+func (s *CachedStore) Info() (map[string]interface{}, error) {
+	return backendInfo(s.Store)
+}
+
+// backendInfo returns the info of a wrapped store, keyed by its type
+func backendInfo(s Store) (map[string]interface{}, error) {
+	out := map[string]interface{}{"backend": fmt.Sprintf("%T", s)}
+	if i, ok := s.(infoer); ok {
+		info, err := i.Info()
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range info {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
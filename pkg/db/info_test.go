@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stuckStore is a store whose server does not answer the pings until released
+type stuckStore struct {
+	*MemoryStore
+	pings   int32
+	release chan struct{}
+}
+
+func (s *stuckStore) Ping(ctx context.Context) error {
+	atomic.AddInt32(&s.pings, 1)
+	<-s.release
+	return nil
+}
+
+func TestPing(t *testing.T) {
+	s := &stuckStore{MemoryStore: &MemoryStore{people: map[string]Person{}}, release: make(chan struct{})}
+	Init(NewEventStore(s))
+
+	// the callers give up on time, and share the ping in flight
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if err := Ping(ctx); err != context.DeadlineExceeded {
+				t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&s.pings); n != 1 {
+		t.Fatalf("got %d pings in flight, want 1", n)
+	}
+
+	// once the server answers a new ping can be sent
+	close(s.release)
+	for i := 0; i < 100; i++ {
+		if err := Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if atomic.LoadInt32(&s.pings) == 2 {
+			return
+		}
+	}
+	t.Fatalf("got %d pings, want a new ping", atomic.LoadInt32(&s.pings))
+}
+
+func TestPingUnsupported(t *testing.T) {
+	Init(&MemoryStore{people: map[string]Person{}})
+	if err := Ping(context.Background()); err != nil {
+		t.Fatalf("got %v, want no error", err)
+	}
+}
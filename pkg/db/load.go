@@ -0,0 +1,381 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxLoadConcurrency = 500
+	maxLoadDuration    = 10 * time.Minute
+	loadPreload        = 100
+)
+
+// loadOps are the operations the load generator can run against the store
+var loadOps = map[string]func(l *loadRun, rnd *rand.Rand) error{
+	"read": func(l *loadRun, rnd *rand.Rand) error {
+		id, ok := l.pick(rnd, false)
+		if !ok {
+			return errNoLoadRecord
+		}
+		_, err := l.store.Get(id)
+		return err
+	},
+	"write": func(l *loadRun, rnd *rand.Rand) error {
+		p := l.newPerson(rnd)
+		if err := l.store.Create(p); err != nil {
+			return err
+		}
+		l.add(p.ID)
+		return nil
+	},
+	"update": func(l *loadRun, rnd *rand.Rand) error {
+		id, ok := l.pick(rnd, false)
+		if !ok {
+			return errNoLoadRecord
+		}
+		p := l.newPerson(rnd)
+		p.ID = id
+		_, err := l.store.Update(p, 0)
+		return err
+	},
+	"delete": func(l *loadRun, rnd *rand.Rand) error {
+		id, ok := l.pick(rnd, true)
+		if !ok {
+			return errNoLoadRecord
+		}
+		return l.store.Delete(id, 0)
+	},
+	"list": func(l *loadRun, rnd *rand.Rand) error {
+		_, _, err := l.store.List(Query{Limit: 10})
+		return err
+	},
+}
+
+var errNoLoadRecord = errors.New("no record left to operate on")
+
+// loadRun keeps the state of one load generator run
+type loadRun struct {
+	// store the workload runs against, the changes are neither published
+	// to the watchers nor recorded in the history
+	store  Store
+	mu     sync.Mutex
+	ids    []string
+	nextID int64
+}
+
+// newPerson returns a person with a new id
+func (l *loadRun) newPerson(rnd *rand.Rand) Person {
+	l.mu.Lock()
+	l.nextID++
+	id := strconv.FormatInt(l.nextID, 10)
+	l.mu.Unlock()
+
+	return Person{
+		ID:        id,
+		Firstname: "Load" + strconv.Itoa(rnd.Intn(1000)),
+		Lastname:  "Test",
+		Address:   &Address{City: "City " + strconv.Itoa(rnd.Intn(100)), State: "State " + strconv.Itoa(rnd.Intn(10))},
+	}
+}
+
+func (l *loadRun) add(id string) {
+	l.mu.Lock()
+	l.ids = append(l.ids, id)
+	l.mu.Unlock()
+}
+
+// pick returns a random id created by this run, remove takes it out of the pool
+func (l *loadRun) pick(rnd *rand.Rand, remove bool) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.ids) == 0 {
+		return "", false
+	}
+	i := rnd.Intn(len(l.ids))
+	id := l.ids[i]
+	if remove {
+		l.ids[i] = l.ids[len(l.ids)-1]
+		l.ids = l.ids[:len(l.ids)-1]
+	}
+	return id, true
+}
+
+// loadWeight is an operation with its share of the workload
+type loadWeight struct {
+	op     string
+	weight int
+}
+
+// parseLoadOps reads the workload mix, e.g. "read:80,write:20"
+func parseLoadOps(s string) ([]loadWeight, int, error) {
+	var weights []loadWeight
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if _, ok := loadOps[kv[0]]; !ok {
+			return nil, 0, fmt.Errorf("unknown operation %q", kv[0])
+		}
+		for _, lw := range weights {
+			if lw.op == kv[0] {
+				return nil, 0, fmt.Errorf("operation %q is listed more than once", kv[0])
+			}
+		}
+		w := 1
+		if len(kv) == 2 {
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n < 0 {
+				return nil, 0, fmt.Errorf("invalid weight for %q", kv[0])
+			}
+			w = n
+		}
+		weights = append(weights, loadWeight{op: kv[0], weight: w})
+		total += w
+	}
+	if total == 0 {
+		return nil, 0, fmt.Errorf("at least one operation needs a weight above 0")
+	}
+	return weights, total, nil
+}
+
+const (
+	// the latencies are counted in buckets growing by 5% from 1µs, which
+	// keeps the memory of a run constant whatever its length
+	latencyMin     = time.Microsecond
+	latencyGrowth  = 1.05
+	latencyBuckets = 512
+)
+
+// latencyHistogram counts latencies in fixed buckets
+type latencyHistogram struct {
+	counts [latencyBuckets]int64
+	count  int64
+	max    time.Duration
+}
+
+// latencyBucket returns the bucket of d, the last bucket takes everything above
+func latencyBucket(d time.Duration) int {
+	if d <= latencyMin {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(latencyMin)) / math.Log(latencyGrowth)))
+	if i >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+	return i
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	h.counts[latencyBucket(d)]++
+	h.count++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *latencyHistogram) merge(o *latencyHistogram) {
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	h.count += o.count
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// percentile in milliseconds, the max for p = 100
+func (h *latencyHistogram) percentile(p float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	if p >= 100 {
+		return float64(h.max) / float64(time.Millisecond)
+	}
+	rank := int64(math.Ceil(float64(h.count) * p / 100))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			d := time.Duration(float64(latencyMin) * math.Pow(latencyGrowth, float64(i)))
+			if d > h.max {
+				d = h.max
+			}
+			return float64(d) / float64(time.Millisecond)
+		}
+	}
+	return float64(h.max) / float64(time.Millisecond)
+}
+
+// loadResult holds what a worker observed for one operation
+type loadResult struct {
+	latencies latencyHistogram
+	errors    map[string]int
+}
+
+// LoadOpReport is the outcome of one operation
+type LoadOpReport struct {
+	Count      int                `json:"count"`
+	Errors     int                `json:"errors"`
+	Throughput float64            `json:"throughput"`
+	LatencyMs  map[string]float64 `json:"latency_ms"`
+}
+
+// LoadReport is the outcome of a load generator run
+type LoadReport struct {
+	Backend     string                   `json:"backend"`
+	Ops         string                   `json:"ops"`
+	Concurrency int                      `json:"concurrency"`
+	Duration    string                   `json:"duration"`
+	Total       int                      `json:"total"`
+	Throughput  float64                  `json:"throughput"`
+	Operations  map[string]*LoadOpReport `json:"operations"`
+	Errors      map[string]int           `json:"errors"`
+}
+
+// Load runs a mixed workload against the store and reports the throughput
+// (ops/s) and latency percentiles of each operation, the run stops early
+// when the client goes away
+// example: curl -X POST 'http://backend:8000/db/load?ops=read:80,write:20&concurrency=50&duration=60s'
+// supported operations: read, write, update, delete, list
+func Load(w http.ResponseWriter, r *http.Request) {
+	opsValue := r.FormValue("ops")
+	if opsValue == "" {
+		opsValue = "read:80,write:20"
+	}
+	weights, totalWeight, err := parseLoadOps(opsValue)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	concurrency := 10
+	if s := r.FormValue("concurrency"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxLoadConcurrency {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("concurrency must be between 1 and %d", maxLoadConcurrency))
+			return
+		}
+		concurrency = n
+	}
+
+	duration := 10 * time.Second
+	if s := r.FormValue("duration"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 || d > maxLoadDuration {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("duration must be between 0s and %s", maxLoadDuration))
+			return
+		}
+		duration = d
+	}
+
+	// the records of a run get ids of their own, far away from the usual ones
+	l := &loadRun{store: unrecorded(store), nextID: time.Now().UnixNano()}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	ctx := r.Context()
+	for i := 0; i < loadPreload && ctx.Err() == nil; i++ {
+		if err := loadOps["write"](l, rnd); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+
+	results := make([]map[string]*loadResult, concurrency)
+	deadline := time.Now().Add(duration)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		res := map[string]*loadResult{}
+		for _, lw := range weights {
+			res[lw.op] = &loadResult{errors: map[string]int{}}
+		}
+		results[i] = res
+
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for time.Now().Before(deadline) && ctx.Err() == nil {
+				n := rnd.Intn(totalWeight)
+				op := weights[0].op
+				for _, lw := range weights {
+					if n < lw.weight {
+						op = lw.op
+						break
+					}
+					n -= lw.weight
+				}
+
+				t := time.Now()
+				err := loadOps[op](l, rnd)
+				res[op].latencies.add(time.Since(t))
+				if err != nil {
+					res[op].errors[err.Error()]++
+				}
+			}
+		}(rnd.Int63())
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// clean up whatever is left of the records of this run
+	for {
+		id, ok := l.pick(rnd, true)
+		if !ok {
+			break
+		}
+		l.store.Delete(id, 0)
+	}
+	if ctx.Err() != nil {
+		log.Printf("Load : the client went away after %s, run stopped\n", elapsed)
+		return
+	}
+
+	report := LoadReport{
+		Backend:     fmt.Sprintf("%T", store),
+		Ops:         opsValue,
+		Concurrency: concurrency,
+		Duration:    elapsed.String(),
+		Operations:  map[string]*LoadOpReport{},
+		Errors:      map[string]int{},
+	}
+	for _, lw := range weights {
+		var latencies latencyHistogram
+		opReport := &LoadOpReport{}
+		for _, res := range results {
+			latencies.merge(&res[lw.op].latencies)
+			for msg, n := range res[lw.op].errors {
+				opReport.Errors += n
+				report.Errors[lw.op+": "+msg] += n
+			}
+		}
+
+		opReport.Count = int(latencies.count)
+		opReport.Throughput = float64(opReport.Count) / elapsed.Seconds()
+		opReport.LatencyMs = map[string]float64{
+			"p50": latencies.percentile(50),
+			"p90": latencies.percentile(90),
+			"p95": latencies.percentile(95),
+			"p99": latencies.percentile(99),
+			"max": latencies.percentile(100),
+		}
+		report.Operations[lw.op] = opReport
+		report.Total += opReport.Count
+	}
+	report.Throughput = float64(report.Total) / elapsed.Seconds()
+
+	writeJSON(w, http.StatusOK, report)
+}
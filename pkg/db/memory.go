@@ -0,0 +1,139 @@
+package db
+
+import (
+	"sync"
+)
+
+// maxMemoryHistory is the number of changes kept in memory, the oldest
+// changes are dropped first
+const maxMemoryHistory = 100000
+
+// MemoryStore keeps person objects in memory, it is safe for concurrent use
+type MemoryStore struct {
+	mu      sync.RWMutex
+	people  map[string]Person
+	history map[string][]Change
+	// order holds the ids of the changes in history, oldest first
+	order []string
+}
+
+// NewMemoryStore returns a MemoryStore seeded with a sample person
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{people: map[string]Person{}}
+	m.Create(Person{ID: "1", Firstname: "John", Lastname: "Doe", Address: &Address{City: "City X", State: "State X"}})
+	// m.Create(Person{ID: "2", Firstname: "Koko", Lastname: "Doe", Address: &Address{City: "City Z", State: "State Y"}})
+	return m
+}
+
+// clone returns a copy of p which does not share the address with p
+func (p Person) clone() Person {
+	if p.Address != nil {
+		a := *p.Address
+		p.Address = &a
+	}
+	return p
+}
+
+// List the person objects selected by q
+func (m *MemoryStore) List(q Query) ([]Person, int, error) {
+	m.mu.RLock()
+	people := make([]Person, 0, len(m.people))
+	for _, p := range m.people {
+		people = append(people, p)
+	}
+	m.mu.RUnlock()
+
+	result, total := q.apply(people)
+	for i := range result {
+		result[i] = result[i].clone()
+	}
+	return result, total, nil
+}
+
+// Get a person object
+func (m *MemoryStore) Get(id string) (Person, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.people[id]
+	if !ok {
+		return Person{}, ErrNotFound
+	}
+	return p.clone(), nil
+}
+
+// Create a person object
+func (m *MemoryStore) Create(p Person) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.people[p.ID]; ok {
+		return ErrExists
+	}
+	p.Version = 1
+	m.people[p.ID] = p.clone()
+	return nil
+}
+
+// Update a person object
+func (m *MemoryStore) Update(p Person, version int64) (Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur, ok := m.people[p.ID]
+	if !ok {
+		return p, ErrNotFound
+	}
+	if version != 0 && cur.Version != version {
+		return p, ErrConflict
+	}
+	p.Version = cur.Version + 1
+	m.people[p.ID] = p.clone()
+	return p, nil
+}
+
+// Delete a person object
+func (m *MemoryStore) Delete(id string, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur, ok := m.people[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if version != 0 && cur.Version != version {
+		return ErrConflict
+	}
+	delete(m.people, id)
+	return nil
+}
+
+func (m *MemoryStore) appendChange(c Change) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.history == nil {
+		m.history = map[string][]Change{}
+	}
+	m.history[c.ID] = append(m.history[c.ID], c)
+	m.order = append(m.order, c.ID)
+	if len(m.order) > maxMemoryHistory {
+		id := m.order[0]
+		m.order = m.order[1:]
+		if len(m.history[id]) == 1 {
+			delete(m.history, id)
+		} else {
+			m.history[id] = m.history[id][1:]
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) changes(id string) ([]Change, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	changes := make([]Change, len(m.history[id]))
+	copy(changes, m.history[id])
+	return changes, nil
+}
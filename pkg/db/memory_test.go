@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMemoryStoreConcurrentCreate(t *testing.T) {
+	m := &MemoryStore{people: map[string]Person{}}
+
+	const workers, ids = 16, 100
+	var created [ids]int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < ids; i++ {
+				err := m.Create(testPerson(fmt.Sprint(i), fmt.Sprint("worker ", w), "", "", ""))
+				switch err {
+				case nil:
+					atomic.AddInt64(&created[i], 1)
+				case ErrExists:
+				default:
+					t.Errorf("create %d: %v", i, err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for i, n := range created {
+		if n != 1 {
+			t.Errorf("id %d: created %d times, want 1", i, n)
+		}
+	}
+	if _, total, _ := m.List(Query{}); total != ids {
+		t.Errorf("got %d people, want %d", total, ids)
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	m := &MemoryStore{people: map[string]Person{}}
+
+	// the stable people are only updated, so their versions only grow, the
+	// churned people are deleted and created again
+	const workers, rounds, stable, churned = 16, 500, 4, 4
+	for i := 0; i < stable; i++ {
+		if err := m.Create(testPerson(fmt.Sprint("s", i), "Ada", "Lovelace", "London", "LDN")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var updates [stable]int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// the latest version seen by this worker for each stable person
+			var seen [stable]int64
+			observe := func(i int, version int64, op string) {
+				if version < seen[i] {
+					t.Errorf("worker %d: %s of s%d: version went from %d to %d", w, op, i, seen[i], version)
+				}
+				seen[i] = version
+			}
+
+			for r := 0; r < rounds; r++ {
+				i := (w + r) % stable
+				id := fmt.Sprint("s", i)
+
+				p, err := m.Get(id)
+				if err != nil {
+					t.Errorf("get %s: %v", id, err)
+					return
+				}
+				observe(i, p.Version, "get")
+
+				// an update at the version read either wins, one past it,
+				// or loses to a concurrent update
+				p.Firstname = fmt.Sprint("worker ", w)
+				switch u, err := m.Update(p, p.Version); err {
+				case nil:
+					if u.Version != p.Version+1 {
+						t.Errorf("update of %s at version %d: got version %d", id, p.Version, u.Version)
+					}
+					atomic.AddInt64(&updates[i], 1)
+					observe(i, u.Version, "update")
+				case ErrConflict:
+				default:
+					t.Errorf("update %s: %v", id, err)
+				}
+
+				// an unconditional update always wins
+				u, err := m.Update(p, 0)
+				if err != nil {
+					t.Errorf("update %s: %v", id, err)
+					return
+				}
+				atomic.AddInt64(&updates[i], 1)
+				observe(i, u.Version, "update")
+
+				result, _, err := m.List(Query{Sort: "id"})
+				if err != nil {
+					t.Errorf("list: %v", err)
+					return
+				}
+				for _, p := range result {
+					var j int
+					if _, err := fmt.Sscanf(p.ID, "s%d", &j); err == nil {
+						observe(j, p.Version, "list")
+					}
+				}
+
+				// churn: create, then delete at the version created
+				cid := fmt.Sprint("c", r%churned)
+				switch err := m.Create(testPerson(cid, "Grace", "Hopper", "New York", "NY")); err {
+				case nil:
+					if err := m.Delete(cid, 1); err != nil && err != ErrNotFound {
+						t.Errorf("delete %s: %v", cid, err)
+					}
+				case ErrExists:
+				default:
+					t.Errorf("create %s: %v", cid, err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// every successful update is counted in the version
+	for i := 0; i < stable; i++ {
+		p, err := m.Get(fmt.Sprint("s", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 1 + updates[i]; p.Version != want {
+			t.Errorf("s%d: got version %d after %d updates, want %d", i, p.Version, updates[i], want)
+		}
+	}
+}
+
+// TestMemoryStoreConcurrentHandlers runs the handlers concurrently against
+// the store wrapped the way the server does, to be run with -race
+func TestMemoryStoreConcurrentHandlers(t *testing.T) {
+	s := newTestHistoryStore(t, &MemoryStore{people: map[string]Person{}})
+	router := testRouter(s)
+
+	// a watcher drains the events while the handlers run
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := s.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range events {
+		}
+	}()
+
+	const workers, rounds = 8, 100
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				url := fmt.Sprint("/db/", r%10)
+				body := fmt.Sprintf(`{"firstname":"worker %d","address":{"city":"worker %d"}}`, w, w)
+
+				switch c := serve(router, "POST", url, body).Code; c {
+				case http.StatusCreated, http.StatusConflict:
+				default:
+					t.Errorf("create %s: got status %d", url, c)
+				}
+				switch c := serve(router, "PUT", url, body).Code; c {
+				case http.StatusOK, http.StatusNotFound:
+				default:
+					t.Errorf("update %s: got status %d", url, c)
+				}
+				if g := serve(router, "GET", url, ""); g.Code == http.StatusOK {
+					var p Person
+					if err := json.NewDecoder(g.Body).Decode(&p); err != nil || p.Address == nil || p.Address.City != p.Firstname {
+						t.Errorf("get %s: got %+v, %v", url, p, err)
+					}
+				}
+				if c := serve(router, "GET", url+"/history", "").Code; c != http.StatusOK {
+					t.Errorf("history %s: got status %d", url, c)
+				}
+				if c := serve(router, "GET", "/db", "").Code; c != http.StatusOK {
+					t.Errorf("get all: got status %d", c)
+				}
+				if r%3 == 0 {
+					switch c := serve(router, "DELETE", url, "").Code; c {
+					case http.StatusNoContent, http.StatusNotFound:
+					default:
+						t.Errorf("delete %s: got status %d", url, c)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,494 @@
+package db
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// mongoHistorySuffix names the collection keeping the history next to the person objects
+const mongoHistorySuffix = "_history"
+
+// mongoModes maps the read preferences to the mgo consistency modes
+var mongoModes = map[string]mgo.Mode{
+	"primary":            mgo.Primary,
+	"primaryPreferred":   mgo.PrimaryPreferred,
+	"secondary":          mgo.Secondary,
+	"secondaryPreferred": mgo.SecondaryPreferred,
+	"nearest":            mgo.Nearest,
+}
+
+// MongoOptions configures the connection to MongoDB
+type MongoOptions struct {
+	// URL is in the form of [mongodb://][user:pass@]host1[:port1][,host2[:port2],...][/database][?options]
+	URL        string
+	Database   string
+	Collection string
+	// AuthSource overrides the database the credentials are checked against
+	AuthSource string
+	PoolLimit  int
+	// Timeout applies to establishing the connection, SocketTimeout to each operation
+	Timeout       time.Duration
+	SocketTimeout time.Duration
+	// ReadPreference is one of primary, primaryPreferred, secondary, secondaryPreferred or nearest
+	ReadPreference string
+	// TLS is implied by CACert
+	TLS    bool
+	CACert string
+	// Retries is the number of times to retry the first connection, 0 retries forever
+	Retries       int
+	RetryInterval time.Duration
+}
+
+// DialMongo connects to MongoDB, retrying while it is not up yet
+func DialMongo(opts MongoOptions) (*mgo.Session, error) {
+	info, err := mgo.ParseURL(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.AuthSource != "" {
+		info.Source = opts.AuthSource
+	}
+	if opts.PoolLimit > 0 {
+		info.PoolLimit = opts.PoolLimit
+	}
+	if opts.Timeout > 0 {
+		info.Timeout = opts.Timeout
+	}
+
+	mode := mgo.Primary
+	if opts.ReadPreference != "" {
+		m, ok := mongoModes[opts.ReadPreference]
+		if !ok {
+			return nil, fmt.Errorf("unknown read preference %q", opts.ReadPreference)
+		}
+		mode = m
+	}
+
+	if opts.TLS || opts.CACert != "" {
+		config := &tls.Config{}
+		if opts.CACert != "" {
+			pem, err := ioutil.ReadFile(opts.CACert)
+			if err != nil {
+				return nil, err
+			}
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", opts.CACert)
+			}
+		}
+		dialer := &net.Dialer{Timeout: info.Timeout}
+		info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.DialWithDialer(dialer, "tcp", addr.String(), config)
+		}
+	}
+
+	interval := opts.RetryInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for i := 1; ; i++ {
+		session, err := mgo.DialWithInfo(info)
+		if err == nil {
+			session.SetMode(mode, true)
+			if opts.SocketTimeout > 0 {
+				session.SetSocketTimeout(opts.SocketTimeout)
+			}
+			return session, nil
+		}
+		if opts.Retries > 0 && i > opts.Retries {
+			return nil, fmt.Errorf("could not connect to mongodb after %d attempts: %v", i, err)
+		}
+		log.Printf("failed to connect to mongodb (attempt %d): %s, retrying in %v", i, err, interval)
+		time.Sleep(interval)
+	}
+}
+
+// MongoStore keeps person objects in a MongoDB collection
+type MongoStore struct {
+	session    *mgo.Session
+	database   string
+	collection string
+}
+
+// NewMongoStore returns a MongoStore backed by the given session and
+// makes sure the person ids are unique
+func NewMongoStore(session *mgo.Session, database string, collection string) (*MongoStore, error) {
+	m := &MongoStore{session: session, database: database, collection: collection}
+
+	c, s := m.getCollection()
+	defer s.Close()
+
+	err := c.EnsureIndex(mgo.Index{Key: []string{"id"}, Unique: true})
+	if err != nil {
+		return nil, err
+	}
+	err = c.Database.C(m.collection + mongoHistorySuffix).EnsureIndex(mgo.Index{Key: []string{"id", "time"}})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *MongoStore) getCollection() (*mgo.Collection, *mgo.Session) {
+	s := m.session.Copy()
+	c := s.DB(m.database).C(m.collection)
+
+	return c, s
+}
+
+// mongoFields maps the Query fields to the document fields
+var mongoFields = map[string]string{
+	"id":        "id",
+	"firstname": "firstname",
+	"lastname":  "lastname",
+	"city":      "address.city",
+	"state":     "address.state",
+}
+
+// List the person objects selected by q
+func (m *MongoStore) List(q Query) ([]Person, int, error) {
+	c, s := m.getCollection()
+	defer s.Close()
+
+	filter := bson.M{}
+	for field, v := range map[string]string{
+		"firstname": q.Firstname,
+		"lastname":  q.Lastname,
+		"city":      q.City,
+		"state":     q.State,
+	} {
+		if v != "" {
+			filter[mongoFields[field]] = v
+		}
+	}
+
+	total, err := c.Find(filter).Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// numeric ids are sorted by length first so 9 comes before 10, the
+	// ids taken by the handlers are numbers
+	order := 1
+	if q.Desc {
+		order = -1
+	}
+	sortBy := bson.D{}
+	if field := q.sortField(); field != "id" {
+		sortBy = append(sortBy, bson.DocElem{Name: mongoFields[field], Value: order})
+	}
+	sortBy = append(sortBy, bson.DocElem{Name: "idlen", Value: order}, bson.DocElem{Name: "id", Value: order})
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$addFields": bson.M{"idlen": bson.M{"$strLenCP": "$id"}}},
+		{"$sort": sortBy},
+	}
+	if q.Offset > 0 {
+		pipeline = append(pipeline, bson.M{"$skip": q.Offset})
+	}
+	if q.Limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": q.Limit})
+	}
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"idlen": 0}})
+
+	result := []Person{}
+	err = c.Pipe(pipeline).All(&result)
+	return result, total, err
+}
+
+// Get a person object
+func (m *MongoStore) Get(id string) (Person, error) {
+	c, s := m.getCollection()
+	defer s.Close()
+
+	p := Person{}
+	err := c.Find(bson.M{"id": id}).One(&p)
+	if err == mgo.ErrNotFound {
+		return p, ErrNotFound
+	}
+	return p, err
+}
+
+// Create a person object
+func (m *MongoStore) Create(p Person) error {
+	c, s := m.getCollection()
+	defer s.Close()
+
+	p.Version = 1
+	err := c.Insert(p)
+	if mgo.IsDup(err) {
+		return ErrExists
+	}
+	return err
+}
+
+// Update a person object
+func (m *MongoStore) Update(p Person, version int64) (Person, error) {
+	c, s := m.getCollection()
+	defer s.Close()
+
+	// the version is bumped by findAndModify so concurrent updates can't
+	// both succeed against the same version
+	change := mgo.Change{
+		Update: bson.M{
+			"$set": bson.M{"firstname": p.Firstname, "lastname": p.Lastname, "address": p.Address},
+			"$inc": bson.M{"version": 1},
+		},
+		ReturnNew: true,
+	}
+	result := Person{}
+	_, err := c.Find(m.selector(p.ID, version)).Apply(change, &result)
+	if err == mgo.ErrNotFound {
+		return p, m.missing(c, p.ID)
+	}
+	return result, err
+}
+
+// Delete a person object
+func (m *MongoStore) Delete(id string, version int64) error {
+	c, s := m.getCollection()
+	defer s.Close()
+
+	err := c.Remove(m.selector(id, version))
+	if err == mgo.ErrNotFound {
+		return m.missing(c, id)
+	}
+	return err
+}
+
+// selector matches the person with id, and version if it is not 0
+func (m *MongoStore) selector(id string, version int64) bson.M {
+	sel := bson.M{"id": id}
+	if version != 0 {
+		sel["version"] = version
+	}
+	return sel
+}
+
+// missing tells why a selector did not match: either the person does not
+// exist or its version has moved on
+func (m *MongoStore) missing(c *mgo.Collection, id string) error {
+	n, err := c.Find(bson.M{"id": id}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrConflict
+	}
+	return ErrNotFound
+}
+
+// mongoChange is a change stream document
+type mongoChange struct {
+	OperationType string  `bson:"operationType"`
+	FullDocument  *Person `bson:"fullDocument"`
+	DocumentKey   struct {
+		ID interface{} `bson:"_id"`
+	} `bson:"documentKey"`
+}
+
+// mongoCursor is the cursor returned by the aggregate and getMore commands
+type mongoCursor struct {
+	Cursor struct {
+		ID         int64         `bson:"id"`
+		FirstBatch []mongoChange `bson:"firstBatch"`
+		NextBatch  []mongoChange `bson:"nextBatch"`
+	} `bson:"cursor"`
+}
+
+// mongoNoChangeStream are the error codes of a server which has no change
+// streams: a standalone mongod (40573) or a version older than 3.6 (16436, 40324)
+var mongoNoChangeStream = map[int]bool{40573: true, 16436: true, 40324: true}
+
+// Watch streams the changes of the collection from a change stream, which
+// requires a replica set (or sharded cluster) running MongoDB 3.6+,
+// ErrWatchUnsupported is returned otherwise
+func (m *MongoStore) Watch(ctx context.Context) (<-chan Event, error) {
+	c, s := m.getCollection()
+
+	// mgo predates change streams, so the cursor is driven with raw commands
+	var res mongoCursor
+	err := c.Database.Run(bson.D{
+		{Name: "aggregate", Value: c.Name},
+		{Name: "pipeline", Value: []bson.M{{"$changeStream": bson.M{"fullDocument": "updateLookup"}}}},
+		{Name: "cursor", Value: bson.M{}},
+	}, &res)
+	if err != nil {
+		s.Close()
+		if e, ok := err.(*mgo.QueryError); ok && mongoNoChangeStream[e.Code] {
+			return nil, ErrWatchUnsupported
+		}
+		return nil, fmt.Errorf("failed to open change stream: %v", err)
+	}
+
+	ch := make(chan Event)
+	go func() {
+		defer s.Close()
+		defer close(ch)
+
+		// the documents only carry the person id while they exist, so the
+		// ids of the documents seen so far are kept to resolve deletes
+		ids := map[string]string{}
+		cursor, batch := res.Cursor.ID, res.Cursor.FirstBatch
+		defer func() {
+			if cursor != 0 {
+				c.Database.Run(bson.D{{Name: "killCursors", Value: c.Name}, {Name: "cursors", Value: []int64{cursor}}}, nil)
+			}
+		}()
+
+		for {
+			for _, change := range batch {
+				e, ok := change.event(ids)
+				if !ok {
+					continue
+				}
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if cursor == 0 || ctx.Err() != nil {
+				return
+			}
+
+			var more mongoCursor
+			err := c.Database.Run(bson.D{
+				{Name: "getMore", Value: cursor},
+				{Name: "collection", Value: c.Name},
+				{Name: "maxTimeMS", Value: int64(time.Second / time.Millisecond)},
+			}, &more)
+			if err != nil {
+				log.Printf("Watch : ERROR : %s\n", err)
+				return
+			}
+			cursor, batch = more.Cursor.ID, more.Cursor.NextBatch
+		}
+	}()
+	return ch, nil
+}
+
+// event converts a change stream document, ids maps the document keys to the person ids
+func (change mongoChange) event(ids map[string]string) (Event, bool) {
+	key := fmt.Sprint(change.DocumentKey.ID)
+	if v, ok := change.DocumentKey.ID.(bson.ObjectId); ok {
+		key = v.Hex()
+	}
+	e := Event{Time: time.Now(), Person: change.FullDocument}
+	if e.Person != nil {
+		ids[key] = e.Person.ID
+		e.ID = e.Person.ID
+	}
+
+	switch change.OperationType {
+	case "insert":
+		e.Type = eventCreate
+	case "update", "replace":
+		e.Type = eventUpdate
+	case "delete":
+		e.Type = eventDelete
+		if id, ok := ids[key]; ok {
+			e.ID = id
+			delete(ids, key)
+		} else {
+			e.Key = key
+		}
+	default:
+		// drop, rename, invalidate, ...
+		return e, false
+	}
+	return e, true
+}
+
+func (m *MongoStore) appendChange(c Change) error {
+	people, s := m.getCollection()
+	defer s.Close()
+
+	return people.Database.C(m.collection + mongoHistorySuffix).Insert(c)
+}
+
+func (m *MongoStore) changes(id string) ([]Change, error) {
+	people, s := m.getCollection()
+	defer s.Close()
+
+	changes := []Change{}
+	err := people.Database.C(m.collection + mongoHistorySuffix).Find(bson.M{"id": id}).Sort("time").All(&changes)
+	return changes, err
+}
+
+// Ping the server, mgo does not take a context: the ping is bounded by the
+// socket timeout of the session instead
+func (m *MongoStore) Ping(ctx context.Context) error {
+	s := m.session.Copy()
+	defer s.Close()
+	return s.Ping()
+}
+
+// mongoMember is a member of a replica set as reported by replSetGetStatus
+type mongoMember struct {
+	Name     string    `bson:"name" json:"name"`
+	State    string    `bson:"stateStr" json:"state"`
+	Health   float64   `bson:"health" json:"health"`
+	Uptime   int64     `bson:"uptime" json:"uptime"`
+	Optime   time.Time `bson:"optimeDate" json:"optime"`
+	Self     bool      `bson:"self" json:"self,omitempty"`
+	SyncFrom string    `bson:"syncingTo" json:"sync_from,omitempty"`
+}
+
+// Info reports the server version and the replica set topology
+func (m *MongoStore) Info() (map[string]interface{}, error) {
+	s := m.session.Copy()
+	defer s.Close()
+
+	build, err := s.BuildInfo()
+	if err != nil {
+		return nil, err
+	}
+	info := map[string]interface{}{
+		"version":      build.Version,
+		"database":     m.database,
+		"collection":   m.collection,
+		"mode":         s.Mode(),
+		"live_servers": s.LiveServers(),
+	}
+
+	var master struct {
+		SetName string   `bson:"setName"`
+		Primary string   `bson:"primary"`
+		Me      string   `bson:"me"`
+		Hosts   []string `bson:"hosts"`
+	}
+	if err := s.Run("isMaster", &master); err != nil {
+		return nil, err
+	}
+	info["primary"] = master.Primary
+	info["connected_to"] = master.Me
+
+	if master.SetName == "" {
+		// standalone server
+		return info, nil
+	}
+	var status struct {
+		Set     string        `bson:"set"`
+		Members []mongoMember `bson:"members"`
+	}
+	if err := s.Run("replSetGetStatus", &status); err != nil {
+		// e.g. the user is not allowed to run it
+		info["replica_set"] = master.SetName
+		info["hosts"] = master.Hosts
+		info["members_error"] = err.Error()
+		return info, nil
+	}
+	info["replica_set"] = status.Set
+	info["members"] = status.Members
+	return info, nil
+}
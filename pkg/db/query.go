@@ -0,0 +1,191 @@
+package db
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxLimit = 1000
+
+// sortFields are the fields a list can be sorted by
+var sortFields = map[string]func(p Person) string{
+	"id":        func(p Person) string { return p.ID },
+	"firstname": func(p Person) string { return p.Firstname },
+	"lastname":  func(p Person) string { return p.Lastname },
+	"city": func(p Person) string {
+		if p.Address == nil {
+			return ""
+		}
+		return p.Address.City
+	},
+	"state": func(p Person) string {
+		if p.Address == nil {
+			return ""
+		}
+		return p.Address.State
+	},
+}
+
+// Query filters, sorts and pages the person objects returned by Store.List,
+// the zero value returns every person object sorted by id
+type Query struct {
+	// filters, an empty value matches everything
+	Firstname string
+	Lastname  string
+	City      string
+	State     string
+
+	// Sort is one of id, firstname, lastname, city or state (default: id)
+	Sort string
+	Desc bool
+
+	Offset int
+	// Limit is the max number of person objects returned, 0 means no limit
+	Limit int
+
+	// paged is set when the request asked for a page (limit, offset or
+	// cursor), the response then carries the total and the next cursor
+	paged bool
+}
+
+// ParseQuery reads a Query from the url parameters
+// example: /db?lastname=Doe&sort=-firstname&limit=10&cursor=MTA
+func ParseQuery(v url.Values) (Query, error) {
+	q := Query{
+		Firstname: v.Get("firstname"),
+		Lastname:  v.Get("lastname"),
+		City:      v.Get("city"),
+		State:     v.Get("state"),
+		Sort:      "id",
+	}
+
+	if s := v.Get("sort"); s != "" {
+		if strings.HasPrefix(s, "-") {
+			q.Desc = true
+			s = s[1:]
+		}
+		if _, ok := sortFields[s]; !ok {
+			return q, fmt.Errorf("invalid sort field %q", s)
+		}
+		q.Sort = s
+	}
+
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		q.Limit = n
+	}
+
+	if s := v.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid offset %q", s)
+		}
+		q.Offset = n
+	}
+	if s := v.Get("cursor"); s != "" {
+		n, err := decodeCursor(s)
+		if err != nil {
+			return q, fmt.Errorf("invalid cursor %q", s)
+		}
+		q.Offset = n
+	}
+	q.paged = v.Get("limit") != "" || v.Get("offset") != "" || v.Get("cursor") != ""
+	return q, nil
+}
+
+// encodeCursor returns the opaque cursor pointing at offset. A cursor is a
+// position in the sorted list, not a bookmark on a person object: when
+// person objects matching the query are created or deleted between two
+// pages, the next page skips or repeats as many rows
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(string(b))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return n, nil
+}
+
+// sortField returns the field to sort by, falling back to id
+func (q Query) sortField() string {
+	if _, ok := sortFields[q.Sort]; ok {
+		return q.Sort
+	}
+	return "id"
+}
+
+// match tells whether p passes the filters of q
+func (q Query) match(p Person) bool {
+	var city, state string
+	if p.Address != nil {
+		city, state = p.Address.City, p.Address.State
+	}
+	return (q.Firstname == "" || q.Firstname == p.Firstname) &&
+		(q.Lastname == "" || q.Lastname == p.Lastname) &&
+		(q.City == "" || q.City == city) &&
+		(q.State == "" || q.State == state)
+}
+
+// apply filters, sorts and pages people in memory, it returns the page and
+// the number of person objects matching the filters
+func (q Query) apply(people []Person) ([]Person, int) {
+	matched := people[:0:0]
+	for _, p := range people {
+		if q.match(p) {
+			matched = append(matched, p)
+		}
+	}
+
+	field := sortFields[q.sortField()]
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if q.Desc {
+			a, b = b, a
+		}
+		if x, y := field(a), field(b); q.sortField() != "id" && x != y {
+			return x < y
+		}
+		// ties are broken by id to keep the pages stable
+		return lessID(a.ID, b.ID)
+	})
+
+	total := len(matched)
+	if q.Offset >= total {
+		return []Person{}, total
+	}
+	matched = matched[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(matched) {
+		matched = matched[:q.Limit]
+	}
+	return matched, total
+}
+
+// lessID compares ids numerically when both are numbers (so 9 comes before
+// 10), numbers come before other ids which are compared as strings
+func lessID(a string, b string) bool {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil && x != y:
+		return x < y
+	case errA == nil && errB != nil:
+		return true
+	case errA != nil && errB == nil:
+		return false
+	}
+	return a < b
+}
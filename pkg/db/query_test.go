@@ -0,0 +1,134 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    Query
+		wantErr bool
+	}{
+		{"", Query{Sort: "id"}, false},
+		{"lastname=Doe&city=X", Query{Lastname: "Doe", City: "X", Sort: "id"}, false},
+		{"firstname=John&state=Y", Query{Firstname: "John", State: "Y", Sort: "id"}, false},
+		{"sort=lastname", Query{Sort: "lastname"}, false},
+		{"sort=-city", Query{Sort: "city", Desc: true}, false},
+		{"limit=10&offset=20", Query{Sort: "id", Limit: 10, Offset: 20, paged: true}, false},
+		{"limit=1000", Query{Sort: "id", Limit: 1000, paged: true}, false},
+		{"cursor=" + encodeCursor(30), Query{Sort: "id", Offset: 30, paged: true}, false},
+		// the cursor wins over the offset
+		{"offset=5&cursor=" + encodeCursor(30), Query{Sort: "id", Offset: 30, paged: true}, false},
+		{"sort=age", Query{}, true},
+		{"sort=-", Query{}, true},
+		{"limit=0", Query{}, true},
+		{"limit=1001", Query{}, true},
+		{"limit=ten", Query{}, true},
+		{"offset=-1", Query{}, true},
+		{"cursor=!!", Query{}, true},
+		{"cursor=" + encodeCursor(-1), Query{}, true},
+	}
+	for _, tt := range tests {
+		v, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseQuery(v)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: got %+v, want an error", tt.query, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %+v, %v, want %+v", tt.query, got, err, tt.want)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	for _, offset := range []int{0, 1, 10, 12345} {
+		if got, err := decodeCursor(encodeCursor(offset)); err != nil || got != offset {
+			t.Errorf("%d: got %d, %v", offset, got, err)
+		}
+	}
+}
+
+func TestLessID(t *testing.T) {
+	// sorted as the stores sort ids
+	want := []string{"1", "9", "10", "99", "100", "a", "b10", "b9"}
+	got := []string{"b9", "100", "a", "10", "1", "b10", "99", "9"}
+	people := make([]Person, len(got))
+	for i, id := range got {
+		people[i] = Person{ID: id}
+	}
+	result, _ := Query{}.apply(people)
+	for i := range result {
+		got[i] = result[i].ID
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetAllPages(t *testing.T) {
+	s := &MemoryStore{people: map[string]Person{}}
+	for i := 1; i <= 25; i++ {
+		if err := s.Create(testPerson(fmt.Sprint(i), "John", "Doe", "X", "Y")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := testRouter(s)
+
+	// without paging the body is the plain array
+	w := serve(router, "GET", "/db?lastname=Doe", "")
+	var all []Person
+	if err := json.NewDecoder(w.Body).Decode(&all); err != nil || len(all) != 25 {
+		t.Fatalf("get all: got %d people, %v", len(all), err)
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "25" {
+		t.Fatalf("get all: got X-Total-Count %q", got)
+	}
+
+	// walk the pages following the cursors
+	var ids []string
+	next := "/db?sort=id&limit=10"
+	for pages := 0; next != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		w := serve(router, "GET", next, "")
+		if w.Code != 200 {
+			t.Fatalf("%s: got status %d", next, w.Code)
+		}
+		var p page
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Total != 25 || w.Header().Get("X-Total-Count") != "25" {
+			t.Fatalf("%s: got total %d, X-Total-Count %q", next, p.Total, w.Header().Get("X-Total-Count"))
+		}
+		if got := w.Header().Get("X-Next-Cursor"); got != p.NextCursor {
+			t.Fatalf("%s: got X-Next-Cursor %q, next_cursor %q", next, got, p.NextCursor)
+		}
+		for _, person := range p.People {
+			ids = append(ids, person.ID)
+		}
+		next = ""
+		if p.NextCursor != "" {
+			next = "/db?sort=id&limit=10&cursor=" + p.NextCursor
+		}
+	}
+	if len(ids) != 25 || ids[0] != "1" || ids[9] != "10" || ids[24] != "25" {
+		t.Fatalf("got ids %v", ids)
+	}
+
+	if w := serve(router, "GET", "/db?limit=0", ""); w.Code != 400 {
+		t.Fatalf("invalid limit: got status %d", w.Code)
+	}
+}
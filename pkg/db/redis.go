@@ -0,0 +1,435 @@
+package db
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	redisPeopleKey   = "people"
+	redisPersonKey   = "person:"
+	redisCacheKey    = "cache:person:"
+	redisHistoryKey  = "history:person:"
+	redisMaxIdle     = 10
+	redisIdleTimeout = 240 * time.Second
+	redisMaxRetries  = 3
+)
+
+// RedisOptions configures the connection to redis
+type RedisOptions struct {
+	// URL is in the form of redis://[:password@]host:port[/db],
+	// use rediss:// to connect with TLS
+	URL string
+	// CACert is an optional CA bundle used to verify the server certificate
+	// (e.g. the server CA of a Memorystore instance with in-transit encryption)
+	CACert string
+}
+
+func newRedisPool(opts RedisOptions) (*redis.Pool, error) {
+	var dialOpts []redis.DialOption
+	if opts.CACert != "" {
+		pem, err := ioutil.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CACert)
+		}
+		dialOpts = append(dialOpts, redis.DialTLSConfig(&tls.Config{RootCAs: pool}))
+	}
+
+	p := &redis.Pool{
+		MaxIdle:     redisMaxIdle,
+		IdleTimeout: redisIdleTimeout,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(opts.URL, dialOpts...)
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+
+	// fail early if redis is not reachable (or auth/tls is misconfigured)
+	c := p.Get()
+	defer c.Close()
+	if _, err := c.Do("PING"); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// RedisStore keeps person objects in redis as JSON strings under
+// "person:<id>", with the ids tracked in the "people" set
+type RedisStore struct {
+	pool *redis.Pool
+}
+
+// NewRedisStore returns a RedisStore connected with the given options
+func NewRedisStore(opts RedisOptions) (*RedisStore, error) {
+	p, err := newRedisPool(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{pool: p}, nil
+}
+
+// Close the connection pool
+func (s *RedisStore) Close() error {
+	return s.pool.Close()
+}
+
+// List the person objects selected by q, the filtering, sorting and
+// paging happen on the client side
+func (s *RedisStore) List(q Query) ([]Person, int, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	ids, err := redis.Strings(c.Do("SMEMBERS", redisPeopleKey))
+	if err != nil {
+		return nil, 0, err
+	}
+	people := []Person{}
+	if len(ids) == 0 {
+		return people, 0, nil
+	}
+
+	args := redis.Args{}
+	for _, id := range ids {
+		args = args.Add(redisPersonKey + id)
+	}
+	values, err := redis.ByteSlices(c.Do("MGET", args...))
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, v := range values {
+		// the id may have been removed in between SMEMBERS and MGET
+		if v == nil {
+			continue
+		}
+		var p Person
+		if err := json.Unmarshal(v, &p); err != nil {
+			return nil, 0, err
+		}
+		people = append(people, p)
+	}
+	result, total := q.apply(people)
+	return result, total, nil
+}
+
+// Get a person object
+func (s *RedisStore) Get(id string) (Person, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	var p Person
+	v, err := redis.Bytes(c.Do("GET", redisPersonKey+id))
+	if err == redis.ErrNil {
+		return p, ErrNotFound
+	}
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(v, &p)
+	return p, err
+}
+
+// Create a person object, the person and its id are stored in a transaction
+// so List never misses a stored person
+func (s *RedisStore) Create(p Person) error {
+	c := s.pool.Get()
+	defer c.Close()
+
+	p.Version = 1
+	v, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	c.Send("MULTI")
+	c.Send("SET", redisPersonKey+p.ID, v, "NX")
+	c.Send("SADD", redisPeopleKey, p.ID)
+	res, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+	// SET NX replies nil when the key exists, adding the id again is harmless
+	if res[0] == nil {
+		return ErrExists
+	}
+	return nil
+}
+
+// Update a person object
+func (s *RedisStore) Update(p Person, version int64) (Person, error) {
+	err := s.watch(p.ID, version, func(c redis.Conn, cur Person) error {
+		p.Version = cur.Version + 1
+		v, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return c.Send("SET", redisPersonKey+p.ID, v)
+	})
+	return p, err
+}
+
+// Delete a person object
+func (s *RedisStore) Delete(id string, version int64) error {
+	return s.watch(id, version, func(c redis.Conn, cur Person) error {
+		if err := c.Send("DEL", redisPersonKey+id); err != nil {
+			return err
+		}
+		return c.Send("SREM", redisPeopleKey, id)
+	})
+}
+
+// watch runs the commands queued by fn in a transaction which only commits
+// if the person is still at the version it was read at, fn is retried when
+// another client got in between unless a specific version was asked for
+func (s *RedisStore) watch(id string, version int64, fn func(c redis.Conn, cur Person) error) error {
+	c := s.pool.Get()
+	defer c.Close()
+
+	for i := 0; i < redisMaxRetries; i++ {
+		if _, err := c.Do("WATCH", redisPersonKey+id); err != nil {
+			return err
+		}
+		v, err := redis.Bytes(c.Do("GET", redisPersonKey+id))
+		if err != nil {
+			c.Do("UNWATCH")
+			if err == redis.ErrNil {
+				return ErrNotFound
+			}
+			return err
+		}
+		var cur Person
+		if err := json.Unmarshal(v, &cur); err != nil {
+			c.Do("UNWATCH")
+			return err
+		}
+		if version != 0 && cur.Version != version {
+			c.Do("UNWATCH")
+			return ErrConflict
+		}
+
+		if err := c.Send("MULTI"); err != nil {
+			return err
+		}
+		if err := fn(c, cur); err != nil {
+			c.Do("DISCARD")
+			return err
+		}
+		res, err := c.Do("EXEC")
+		if err != nil {
+			return err
+		}
+		// a nil reply means the key was modified after WATCH
+		if res != nil {
+			return nil
+		}
+		if version != 0 {
+			return ErrConflict
+		}
+	}
+	return ErrConflict
+}
+
+// Ping the server
+func (s *RedisStore) Ping(ctx context.Context) error {
+	c, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_, err = redis.DoWithTimeout(c, time.Until(deadline), "PING")
+		return err
+	}
+	_, err = c.Do("PING")
+	return err
+}
+
+func (s *RedisStore) appendChange(c Change) error {
+	v, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	// a person keeps the latest maxMemoryHistory changes, like the MemoryStore
+	conn.Send("MULTI")
+	conn.Send("RPUSH", redisHistoryKey+c.ID, v)
+	conn.Send("LTRIM", redisHistoryKey+c.ID, -maxMemoryHistory, -1)
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+func (s *RedisStore) changes(id string) ([]Change, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	values, err := redis.ByteSlices(conn.Do("LRANGE", redisHistoryKey+id, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]Change, 0, len(values))
+	for _, v := range values {
+		var c Change
+		if err := json.Unmarshal(v, &c); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// CachedStore puts a redis cache in front of another Store (cache-aside):
+// reads are served from redis when possible, writes go to the backing
+// store and invalidate the cached entry. A read racing a write may still
+// cache the object as it was before the write (read from the backing store
+// before the write, cached after the invalidation), it is then served until
+// the ttl expires
+type CachedStore struct {
+	Store
+	pool *redis.Pool
+	ttl  time.Duration
+}
+
+// NewCachedStore returns a CachedStore caching the objects of backend for ttl
+func NewCachedStore(backend Store, opts RedisOptions, ttl time.Duration) (*CachedStore, error) {
+	p, err := newRedisPool(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &CachedStore{Store: backend, pool: p, ttl: ttl}, nil
+}
+
+// Close the connection pool
+func (s *CachedStore) Close() error {
+	return s.pool.Close()
+}
+
+// Get a person object
+func (s *CachedStore) Get(id string) (Person, error) {
+	p, _, err := s.GetCached(id)
+	return p, err
+}
+
+// GetCached gets a person object and reports whether it was a cache hit
+func (s *CachedStore) GetCached(id string) (Person, bool, error) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	var p Person
+	v, err := redis.Bytes(c.Do("GET", redisCacheKey+id))
+	if err == nil {
+		if err := json.Unmarshal(v, &p); err == nil {
+			return p, true, nil
+		}
+	} else if err != redis.ErrNil {
+		// an unavailable cache should not take the backing store down with it
+		log.Printf("Redis cache : ERROR : %s\n", err)
+	}
+
+	p, err = s.Store.Get(id)
+	if err != nil {
+		return p, false, err
+	}
+	if v, err := json.Marshal(p); err == nil {
+		if _, err := c.Do("SET", redisCacheKey+id, v, "PX", int64(s.ttl/time.Millisecond)); err != nil {
+			log.Printf("Redis cache : ERROR : %s\n", err)
+		}
+	}
+	return p, false, nil
+}
+
+// Create a person object
+func (s *CachedStore) Create(p Person) error {
+	if err := s.Store.Create(p); err != nil {
+		return err
+	}
+	s.invalidate(p.ID)
+	return nil
+}
+
+// Update a person object
+func (s *CachedStore) Update(p Person, version int64) (Person, error) {
+	p, err := s.Store.Update(p, version)
+	if err != nil {
+		return p, err
+	}
+	s.invalidate(p.ID)
+	return p, nil
+}
+
+// Delete a person object
+func (s *CachedStore) Delete(id string, version int64) error {
+	if err := s.Store.Delete(id, version); err != nil {
+		return err
+	}
+	s.invalidate(id)
+	return nil
+}
+
+// Watch streams the changes of the backing store
+func (s *CachedStore) Watch(ctx context.Context) (<-chan Event, error) {
+	if w, ok := s.Store.(Watcher); ok {
+		return w.Watch(ctx)
+	}
+	return nil, ErrWatchUnsupported
+}
+
+// withOrigin binds the backing store, the cache is shared
+func (s *CachedStore) withOrigin(requestID string) Store {
+	c := *s
+	c.Store = WithOrigin(s.Store, requestID)
+	return &c
+}
+
+// History returns the changes of the backing store
+func (s *CachedStore) History(id string) ([]Change, error) {
+	if h, ok := s.Store.(historian); ok {
+		return h.History(id)
+	}
+	return nil, ErrHistoryUnsupported
+}
+
+// At reads the backing store as it was at t
+func (s *CachedStore) At(id string, t time.Time) (Person, error) {
+	if h, ok := s.Store.(historian); ok {
+		return h.At(id, t)
+	}
+	return Person{}, ErrHistoryUnsupported
+}
+
+// unrecorded skips the recording of the backing store, the cache is shared
+func (s *CachedStore) unrecorded() Store {
+	c := *s
+	c.Store = unrecorded(s.Store)
+	return &c
+}
+
+// invalidate drops the cached entry of id, the write is already committed by
+// the backing store so a failure is only logged (the entry expires with the ttl)
+func (s *CachedStore) invalidate(id string) {
+	c := s.pool.Get()
+	defer c.Close()
+
+	if _, err := c.Do("DEL", redisCacheKey+id); err != nil {
+		log.Printf("Redis cache : ERROR : %s\n", err)
+	}
+}
@@ -0,0 +1,457 @@
+package db
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-process redis server implementing the commands used by
+// RedisStore and CachedStore, expiry is not implemented
+type fakeRedis struct {
+	lis net.Listener
+
+	mu      sync.Mutex
+	strings map[string]string
+	sets    map[string]map[string]bool
+	lists   map[string][]string
+	// versions are bumped on every write of a key, for WATCH
+	versions map[string]int64
+	conns    map[net.Conn]bool
+}
+
+// fakeRedisStatus is a simple string reply
+type fakeRedisStatus string
+
+// fakeRedisNilArray is the reply of an aborted transaction
+type fakeRedisNilArray struct{}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{lis: lis, conns: map[net.Conn]bool{}}
+	f.flush()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns[conn] = true
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) url() string {
+	return "redis://" + f.lis.Addr().String()
+}
+
+// Close stops the server and drops the connections
+func (f *fakeRedis) Close() {
+	f.lis.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.conns {
+		conn.Close()
+	}
+}
+
+func (f *fakeRedis) flush() {
+	f.strings = map[string]string{}
+	f.sets = map[string]map[string]bool{}
+	f.lists = map[string][]string{}
+	f.versions = map[string]int64{}
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case fakeRedisNilArray:
+		w.WriteString("*-1\r\n")
+	case fakeRedisStatus:
+		w.WriteString("+" + string(v) + "\r\n")
+	case error:
+		w.WriteString("-ERR " + v.Error() + "\r\n")
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	}
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	watched := map[string]int64{}
+	var queued [][]string
+	multi := false
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+
+		var reply interface{}
+		f.mu.Lock()
+		switch {
+		case cmd == "WATCH":
+			for _, k := range args[1:] {
+				watched[k] = f.versions[k]
+			}
+			reply = fakeRedisStatus("OK")
+		case cmd == "UNWATCH":
+			watched = map[string]int64{}
+			reply = fakeRedisStatus("OK")
+		case cmd == "MULTI":
+			multi, queued = true, nil
+			reply = fakeRedisStatus("OK")
+		case cmd == "DISCARD":
+			multi, queued, watched = false, nil, map[string]int64{}
+			reply = fakeRedisStatus("OK")
+		case cmd == "EXEC":
+			reply = fakeRedisNilArray{}
+			aborted := false
+			for k, v := range watched {
+				if f.versions[k] != v {
+					aborted = true
+				}
+			}
+			if !aborted {
+				replies := []interface{}{}
+				for _, q := range queued {
+					replies = append(replies, f.do(strings.ToUpper(q[0]), q[1:]))
+				}
+				reply = replies
+			}
+			multi, queued, watched = false, nil, map[string]int64{}
+		case multi:
+			queued = append(queued, args)
+			reply = fakeRedisStatus("QUEUED")
+		default:
+			reply = f.do(cmd, args[1:])
+		}
+		f.mu.Unlock()
+
+		writeReply(w, reply)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// do runs a command, f.mu must be held
+func (f *fakeRedis) do(cmd string, args []string) interface{} {
+	switch cmd {
+	case "PING":
+		return fakeRedisStatus("PONG")
+	case "SELECT", "AUTH":
+		return fakeRedisStatus("OK")
+	case "FLUSHDB":
+		f.flush()
+		return fakeRedisStatus("OK")
+	case "GET":
+		if v, ok := f.strings[args[0]]; ok {
+			return v
+		}
+		return nil
+	case "SET":
+		_, exists := f.strings[args[0]]
+		for _, opt := range args[2:] {
+			switch strings.ToUpper(opt) {
+			case "NX":
+				if exists {
+					return nil
+				}
+			case "XX":
+				if !exists {
+					return nil
+				}
+			}
+		}
+		f.strings[args[0]] = args[1]
+		f.versions[args[0]]++
+		return fakeRedisStatus("OK")
+	case "MGET":
+		values := []interface{}{}
+		for _, k := range args {
+			if v, ok := f.strings[k]; ok {
+				values = append(values, v)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		return values
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			_, isString := f.strings[k]
+			_, isSet := f.sets[k]
+			_, isList := f.lists[k]
+			if isString || isSet || isList {
+				n++
+				f.versions[k]++
+			}
+			delete(f.strings, k)
+			delete(f.sets, k)
+			delete(f.lists, k)
+		}
+		return n
+	case "SADD":
+		if f.sets[args[0]] == nil {
+			f.sets[args[0]] = map[string]bool{}
+		}
+		n := 0
+		for _, m := range args[1:] {
+			if !f.sets[args[0]][m] {
+				f.sets[args[0]][m] = true
+				n++
+			}
+		}
+		f.versions[args[0]]++
+		return n
+	case "SREM":
+		n := 0
+		for _, m := range args[1:] {
+			if f.sets[args[0]][m] {
+				delete(f.sets[args[0]], m)
+				n++
+			}
+		}
+		f.versions[args[0]]++
+		return n
+	case "SMEMBERS":
+		members := []interface{}{}
+		for m := range f.sets[args[0]] {
+			members = append(members, m)
+		}
+		return members
+	case "RPUSH":
+		f.lists[args[0]] = append(f.lists[args[0]], args[1:]...)
+		f.versions[args[0]]++
+		return len(f.lists[args[0]])
+	case "LRANGE":
+		values := []interface{}{}
+		for _, v := range listRange(f.lists[args[0]], args[1], args[2]) {
+			values = append(values, v)
+		}
+		return values
+	case "LTRIM":
+		f.lists[args[0]] = listRange(f.lists[args[0]], args[1], args[2])
+		f.versions[args[0]]++
+		return fakeRedisStatus("OK")
+	}
+	return errors.New("unknown command " + cmd)
+}
+
+// listRange returns the elements of l from start to stop included, the
+// indexes are counted from the end when negative as redis does
+func listRange(l []string, start string, stop string) []string {
+	i, _ := strconv.Atoi(start)
+	j, _ := strconv.Atoi(stop)
+	if i < 0 {
+		i += len(l)
+	}
+	if j < 0 {
+		j += len(l)
+	}
+	if i < 0 {
+		i = 0
+	}
+	if j >= len(l) {
+		j = len(l) - 1
+	}
+	if i > j {
+		return nil
+	}
+	return l[i : j+1]
+}
+
+// testRedisURL returns the redis to test against, TEST_REDIS_URL (which is
+// flushed) if set, an in-process fake otherwise
+func testRedisURL(t *testing.T) (string, func()) {
+	if u := os.Getenv("TEST_REDIS_URL"); u != "" {
+		return u, func() {}
+	}
+	f := newFakeRedis(t)
+	return f.url(), f.Close
+}
+
+func TestRedisStore(t *testing.T) {
+	u, done := testRedisURL(t)
+	defer done()
+
+	var stores []*RedisStore
+	defer func() {
+		for _, s := range stores {
+			s.Close()
+		}
+	}()
+	testStore(t, func(t *testing.T) Store {
+		s, err := NewRedisStore(RedisOptions{URL: u})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, s)
+		c := s.pool.Get()
+		defer c.Close()
+		if _, err := c.Do("FLUSHDB"); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestRedisStoreHistory(t *testing.T) {
+	u, done := testRedisURL(t)
+	defer done()
+	s, err := NewRedisStore(RedisOptions{URL: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := s.pool.Get()
+	defer c.Close()
+	if _, err := c.Do("FLUSHDB"); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHistoryStore(t, s)
+
+	if err := h.Create(testPerson("101", "Ada", "Lovelace", "London", "LDN")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Update(testPerson("101", "Ada", "King", "London", "LDN"), 1); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := h.History("101")
+	if err != nil || len(changes) != 2 || changes[1].Person == nil || changes[1].Person.Lastname != "King" {
+		t.Fatalf("History: got %+v, %v", changes, err)
+	}
+}
+
+func TestCachedStore(t *testing.T) {
+	u, done := testRedisURL(t)
+	defer done()
+
+	var stores []*CachedStore
+	defer func() {
+		for _, s := range stores {
+			s.Close()
+		}
+	}()
+	testStore(t, func(t *testing.T) Store {
+		s, err := NewCachedStore(&MemoryStore{people: map[string]Person{}}, RedisOptions{URL: u}, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, s)
+		c := s.pool.Get()
+		defer c.Close()
+		if _, err := c.Do("FLUSHDB"); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestCachedStoreHits(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.Close()
+
+	backend := &MemoryStore{people: map[string]Person{}}
+	s, err := NewCachedStore(backend, RedisOptions{URL: f.url()}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Create(testPerson("101", "Ada", "Lovelace", "London", "LDN")); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{false, true} {
+		p, hit, err := s.GetCached("101")
+		if err != nil || hit != want || p.Lastname != "Lovelace" {
+			t.Fatalf("get %d: got %+v, hit %v, %v, want hit %v", i, p, hit, err, want)
+		}
+	}
+
+	// a write invalidates the cached entry
+	if _, err := s.Update(testPerson("101", "Ada", "King", "London", "LDN"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if p, hit, err := s.GetCached("101"); err != nil || hit || p.Lastname != "King" {
+		t.Fatalf("get after update: got %+v, hit %v, %v", p, hit, err)
+	}
+
+	// without redis the backing store is still served, and the writes
+	// committed by the backing store succeed
+	f.Close()
+	if p, hit, err := s.GetCached("101"); err != nil || hit || p.Lastname != "King" {
+		t.Fatalf("get without redis: got %+v, hit %v, %v", p, hit, err)
+	}
+	if err := s.Create(testPerson("102", "Grace", "Hopper", "New York", "NY")); err != nil {
+		t.Fatalf("create without redis: %v", err)
+	}
+	if _, err := s.Update(testPerson("102", "Grace", "Hopper", "Arlington", "VA"), 1); err != nil {
+		t.Fatalf("update without redis: %v", err)
+	}
+	if err := s.Delete("102", 2); err != nil {
+		t.Fatalf("delete without redis: %v", err)
+	}
+	if _, err := backend.Get("102"); err != ErrNotFound {
+		t.Fatalf("backing store: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,385 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+var sqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS people (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		firstname VARCHAR(255) NOT NULL DEFAULT '',
+		lastname VARCHAR(255) NOT NULL DEFAULT '',
+		version BIGINT NOT NULL DEFAULT 1
+	)`,
+	`CREATE TABLE IF NOT EXISTS addresses (
+		person_id VARCHAR(64) NOT NULL PRIMARY KEY,
+		city VARCHAR(255) NOT NULL DEFAULT '',
+		state VARCHAR(255) NOT NULL DEFAULT '',
+		FOREIGN KEY (person_id) REFERENCES people(id) ON DELETE CASCADE
+	)`,
+	// the person object after the change is kept as JSON, the time in
+	// nanoseconds since the epoch to be read back the same way by both
+	// drivers. Two changes may share the same time (e.g. two pods with the
+	// same clock), they are told apart by a serial id
+	`CREATE TABLE IF NOT EXISTS person_history (
+		id {serial} NOT NULL PRIMARY KEY,
+		person_id VARCHAR(64) NOT NULL,
+		type VARCHAR(16) NOT NULL,
+		version BIGINT NOT NULL DEFAULT 0,
+		person TEXT,
+		changed_at BIGINT NOT NULL,
+		host VARCHAR(255) NOT NULL DEFAULT '',
+		request_id VARCHAR(255) NOT NULL DEFAULT ''
+	)`,
+}
+
+// sqlSerial is the type of an auto incremented column, it replaces {serial}
+// in sqlSchema
+var sqlSerial = map[string]string{
+	"postgres": "BIGSERIAL",
+	"mysql":    "BIGINT AUTO_INCREMENT",
+}
+
+// sqlMigrations bring the tables created by an older release up to date,
+// each one is only run when its probe query fails
+var sqlMigrations = []struct{ probe, stmt string }{
+	{"SELECT version FROM people WHERE 1 = 0", "ALTER TABLE people ADD COLUMN version BIGINT NOT NULL DEFAULT 1"},
+}
+
+const sqlSelectPerson = `SELECT p.id, p.firstname, p.lastname, p.version, a.city, a.state
+	FROM people p LEFT JOIN addresses a ON a.person_id = p.id`
+
+// SQLStore keeps person objects in a SQL database (postgres or mysql)
+type SQLStore struct {
+	db     *sql.DB
+	driver string
+}
+
+// NewSQLStore opens the database with the given driver and dsn and
+// creates the schema if it does not exist yet
+func NewSQLStore(driver string, dsn string) (*SQLStore, error) {
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &SQLStore{db: conn, driver: driver}
+	for _, stmt := range sqlSchema {
+		stmt = strings.Replace(stmt, "{serial}", sqlSerial[driver], -1)
+		if _, err := conn.Exec(stmt); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create schema: %v", err)
+		}
+	}
+	for _, m := range sqlMigrations {
+		if _, err := conn.Exec(m.probe); err == nil {
+			continue
+		}
+		if _, err := conn.Exec(m.stmt); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to migrate schema: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// Close the underlying database handle
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// Ping the database
+func (s *SQLStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// rebind converts the '?' placeholders to the style used by the driver
+func (s *SQLStore) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPerson(row rowScanner) (Person, error) {
+	var p Person
+	var city, state sql.NullString
+	if err := row.Scan(&p.ID, &p.Firstname, &p.Lastname, &p.Version, &city, &state); err != nil {
+		return p, err
+	}
+	if city.Valid || state.Valid {
+		p.Address = &Address{City: city.String, State: state.String}
+	}
+	return p, nil
+}
+
+// sqlColumns maps the Query fields to the columns of sqlSelectPerson
+var sqlColumns = map[string]string{
+	"id":        "p.id",
+	"firstname": "p.firstname",
+	"lastname":  "p.lastname",
+	"city":      "COALESCE(a.city, '')",
+	"state":     "COALESCE(a.state, '')",
+}
+
+// List the person objects selected by q
+func (s *SQLStore) List(q Query) ([]Person, int, error) {
+	var where []string
+	var args []interface{}
+	for _, f := range []struct{ field, value string }{
+		{"firstname", q.Firstname},
+		{"lastname", q.Lastname},
+		{"city", q.City},
+		{"state", q.State},
+	} {
+		if f.value != "" {
+			where = append(where, sqlColumns[f.field]+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	err := s.db.QueryRow(s.rebind("SELECT COUNT(*) FROM people p LEFT JOIN addresses a ON a.person_id = p.id"+cond), args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	order := "ASC"
+	if q.Desc {
+		order = "DESC"
+	}
+	limit := q.Limit
+	if limit == 0 {
+		// mysql does not support OFFSET without LIMIT
+		limit = math.MaxInt32
+	}
+	// numeric ids are sorted by length first so 9 comes before 10, the
+	// ids taken by the handlers are numbers
+	var orderBy []string
+	if field := q.sortField(); field != "id" {
+		orderBy = append(orderBy, sqlColumns[field]+" "+order)
+	}
+	orderBy = append(orderBy, "LENGTH(p.id) "+order, "p.id "+order)
+	query := fmt.Sprintf("%s%s ORDER BY %s LIMIT ? OFFSET ?",
+		sqlSelectPerson, cond, strings.Join(orderBy, ", "))
+	rows, err := s.db.Query(s.rebind(query), append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	result := []Person{}
+	for rows.Next() {
+		p, err := scanPerson(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, p)
+	}
+	return result, total, rows.Err()
+}
+
+// Get a person object
+func (s *SQLStore) Get(id string) (Person, error) {
+	row := s.db.QueryRow(s.rebind(sqlSelectPerson+" WHERE p.id = ?"), id)
+	p, err := scanPerson(row)
+	if err == sql.ErrNoRows {
+		return p, ErrNotFound
+	}
+	return p, err
+}
+
+// Create a person object
+func (s *SQLStore) Create(p Person) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(s.rebind("INSERT INTO people (id, firstname, lastname, version) VALUES (?, ?, ?, 1)"),
+			p.ID, p.Firstname, p.Lastname); err != nil {
+			if isDuplicate(err) {
+				return ErrExists
+			}
+			return err
+		}
+		return s.insertAddress(tx, p)
+	})
+}
+
+// Update a person object
+func (s *SQLStore) Update(p Person, version int64) (Person, error) {
+	err := s.withTx(func(tx *sql.Tx) error {
+		cur, err := s.version(tx, p.ID, version)
+		if err != nil {
+			return err
+		}
+
+		// the version in the WHERE clause guards against a concurrent update
+		// which committed after the version above was read
+		res, err := tx.Exec(s.rebind("UPDATE people SET firstname = ?, lastname = ?, version = ? WHERE id = ? AND version = ?"),
+			p.Firstname, p.Lastname, cur+1, p.ID, cur)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrConflict
+		}
+		p.Version = cur + 1
+
+		if _, err := tx.Exec(s.rebind("DELETE FROM addresses WHERE person_id = ?"), p.ID); err != nil {
+			return err
+		}
+		return s.insertAddress(tx, p)
+	})
+	return p, err
+}
+
+// Delete a person object
+func (s *SQLStore) Delete(id string, version int64) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		cur, err := s.version(tx, id, version)
+		if err != nil {
+			return err
+		}
+
+		// not every table enforces ON DELETE CASCADE (e.g. mysql with the
+		// MyISAM engine ignores foreign keys), so the address is removed explicitly
+		if _, err := tx.Exec(s.rebind("DELETE FROM addresses WHERE person_id = ?"), id); err != nil {
+			return err
+		}
+		res, err := tx.Exec(s.rebind("DELETE FROM people WHERE id = ? AND version = ?"), id, cur)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrConflict
+		}
+		return nil
+	})
+}
+
+// version returns the stored version of a person, checked against version if it is not 0
+func (s *SQLStore) version(tx *sql.Tx, id string, version int64) (int64, error) {
+	var cur int64
+	err := tx.QueryRow(s.rebind("SELECT version FROM people WHERE id = ?"), id).Scan(&cur)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if version != 0 && cur != version {
+		return 0, ErrConflict
+	}
+	return cur, nil
+}
+
+func (s *SQLStore) insertAddress(tx *sql.Tx, p Person) error {
+	if p.Address == nil {
+		return nil
+	}
+	_, err := tx.Exec(s.rebind("INSERT INTO addresses (person_id, city, state) VALUES (?, ?, ?)"),
+		p.ID, p.Address.City, p.Address.State)
+	return err
+}
+
+func (s *SQLStore) appendChange(c Change) error {
+	var person sql.NullString
+	if c.Person != nil {
+		b, err := json.Marshal(c.Person)
+		if err != nil {
+			return err
+		}
+		person = sql.NullString{String: string(b), Valid: true}
+	}
+	_, err := s.db.Exec(s.rebind(`INSERT INTO person_history (person_id, type, version, person, changed_at, host, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`), c.ID, c.Type, c.Version, person, c.Time.UnixNano(), c.Host, c.RequestID)
+	return err
+}
+
+func (s *SQLStore) changes(id string) ([]Change, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT type, version, person, changed_at, host, request_id
+		FROM person_history WHERE person_id = ? ORDER BY changed_at, id`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []Change{}
+	for rows.Next() {
+		c := Change{ID: id}
+		var person sql.NullString
+		var changedAt int64
+		if err := rows.Scan(&c.Type, &c.Version, &person, &changedAt, &c.Host, &c.RequestID); err != nil {
+			return nil, err
+		}
+		if person.Valid {
+			c.Person = &Person{}
+			if err := json.Unmarshal([]byte(person.String), c.Person); err != nil {
+				return nil, err
+			}
+		}
+		c.Time = time.Unix(0, changedAt).UTC()
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// isDuplicate tells whether err is a unique constraint violation
+func isDuplicate(err error) bool {
+	switch e := err.(type) {
+	case *pq.Error:
+		return e.Code == "23505"
+	case *mysql.MySQLError:
+		return e.Number == 1062
+	}
+	return false
+}
+
+// withTx runs fn in a transaction, which is committed if fn succeeds
+func (s *SQLStore) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
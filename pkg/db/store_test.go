@@ -0,0 +1,280 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testStore runs the conformance tests every Store must pass, newStore
+// returns an empty store for each test
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	t.Run("Get", func(t *testing.T) { testStoreGet(t, newStore(t)) })
+	t.Run("Create", func(t *testing.T) { testStoreCreate(t, newStore(t)) })
+	t.Run("Update", func(t *testing.T) { testStoreUpdate(t, newStore(t)) })
+	t.Run("Delete", func(t *testing.T) { testStoreDelete(t, newStore(t)) })
+	t.Run("List", func(t *testing.T) { testStoreList(t, newStore(t)) })
+}
+
+func testPerson(id string, firstname string, lastname string, city string, state string) Person {
+	return Person{ID: id, Firstname: firstname, Lastname: lastname, Address: &Address{City: city, State: state}}
+}
+
+func testStoreGet(t *testing.T, s Store) {
+	if _, err := s.Get("404"); err != ErrNotFound {
+		t.Fatalf("Get of a missing person: got %v, want ErrNotFound", err)
+	}
+
+	want := testPerson("101", "Ada", "Lovelace", "London", "LDN")
+	if err := s.Create(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get("101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Version = 1
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Get: got %+v, want %+v", got, want)
+	}
+
+	// the person returned is a copy
+	got.Address.City = "Paris"
+	if again, _ := s.Get("101"); again.Address.City != "London" {
+		t.Fatalf("Get: changing the person returned changed the stored one")
+	}
+
+	// a person without an address
+	if err := s.Create(Person{ID: "102", Firstname: "Alan"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get("102"); err != nil || got.Address != nil || got.Firstname != "Alan" {
+		t.Fatalf("Get of a person without address: got %+v, %v", got, err)
+	}
+}
+
+func testStoreCreate(t *testing.T, s Store) {
+	p := testPerson("101", "Ada", "Lovelace", "London", "LDN")
+	// the version given is ignored, a new person is at version 1
+	p.Version = 7
+	if err := s.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("101"); got.Version != 1 {
+		t.Fatalf("Create: got version %d, want 1", got.Version)
+	}
+
+	if err := s.Create(testPerson("101", "Grace", "Hopper", "New York", "NY")); err != ErrExists {
+		t.Fatalf("Create of an existing id: got %v, want ErrExists", err)
+	}
+	if got, _ := s.Get("101"); got.Firstname != "Ada" {
+		t.Fatalf("Create of an existing id replaced the person: got %+v", got)
+	}
+}
+
+func testStoreUpdate(t *testing.T, s Store) {
+	if _, err := s.Update(testPerson("404", "Nobody", "", "", ""), 0); err != ErrNotFound {
+		t.Fatalf("Update of a missing person: got %v, want ErrNotFound", err)
+	}
+
+	if err := s.Create(testPerson("101", "Ada", "Lovelace", "London", "LDN")); err != nil {
+		t.Fatal(err)
+	}
+
+	// version 0 updates whatever the stored version is
+	p, err := s.Update(testPerson("101", "Ada", "King", "London", "LDN"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != 2 {
+		t.Fatalf("Update: got version %d, want 2", p.Version)
+	}
+
+	if _, err := s.Update(testPerson("101", "Ada", "Byron", "London", "LDN"), 1); err != ErrConflict {
+		t.Fatalf("Update of a stale version: got %v, want ErrConflict", err)
+	}
+	if got, _ := s.Get("101"); got.Lastname != "King" || got.Version != 2 {
+		t.Fatalf("Update of a stale version changed the person: got %+v", got)
+	}
+
+	p, err = s.Update(testPerson("101", "Ada", "Byron", "Paris", "IDF"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testPerson("101", "Ada", "Byron", "Paris", "IDF")
+	want.Version = 3
+	if got, _ := s.Get("101"); !reflect.DeepEqual(got, want) || !reflect.DeepEqual(p, want) {
+		t.Fatalf("Update: got %+v (returned %+v), want %+v", got, p, want)
+	}
+}
+
+func testStoreDelete(t *testing.T, s Store) {
+	if err := s.Delete("404", 0); err != ErrNotFound {
+		t.Fatalf("Delete of a missing person: got %v, want ErrNotFound", err)
+	}
+
+	if err := s.Create(testPerson("101", "Ada", "Lovelace", "London", "LDN")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("101", 2); err != ErrConflict {
+		t.Fatalf("Delete of a stale version: got %v, want ErrConflict", err)
+	}
+	if _, err := s.Get("101"); err != nil {
+		t.Fatalf("Delete of a stale version removed the person: %v", err)
+	}
+	if err := s.Delete("101", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("101"); err != ErrNotFound {
+		t.Fatalf("Get of a deleted person: got %v, want ErrNotFound", err)
+	}
+	if err := s.Delete("101", 0); err != ErrNotFound {
+		t.Fatalf("Delete of a deleted person: got %v, want ErrNotFound", err)
+	}
+
+	// the id can be used again, from version 1
+	if err := s.Create(testPerson("101", "Grace", "Hopper", "New York", "NY")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("101"); got.Version != 1 || got.Firstname != "Grace" {
+		t.Fatalf("Create after Delete: got %+v", got)
+	}
+}
+
+func testStoreList(t *testing.T, s Store) {
+	people := []Person{
+		testPerson("101", "Ada", "Lovelace", "London", "LDN"),
+		testPerson("102", "Grace", "Hopper", "New York", "NY"),
+		testPerson("103", "Alan", "Turing", "London", "LDN"),
+		testPerson("104", "Edsger", "Dijkstra", "Austin", "TX"),
+		testPerson("105", "Barbara", "Liskov", "Boston", "MA"),
+		{ID: "106", Firstname: "Claude", Lastname: "Shannon"},
+	}
+	for _, p := range people {
+		if err := s.Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(result []Person) []string {
+		out := []string{}
+		for _, p := range result {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		name  string
+		q     Query
+		ids   []string
+		total int
+	}{
+		{"all", Query{}, []string{"101", "102", "103", "104", "105", "106"}, 6},
+		{"by city", Query{City: "London"}, []string{"101", "103"}, 2},
+		{"by state", Query{State: "TX"}, []string{"104"}, 1},
+		{"by firstname and lastname", Query{Firstname: "Grace", Lastname: "Hopper"}, []string{"102"}, 1},
+		{"no match", Query{Lastname: "Nobody"}, []string{}, 0},
+		{"sorted", Query{Sort: "firstname"}, []string{"101", "103", "105", "106", "104", "102"}, 6},
+		{"sorted desc", Query{Sort: "lastname", Desc: true}, []string{"103", "106", "101", "105", "102", "104"}, 6},
+		{"ties by id", Query{Sort: "city"}, []string{"106", "104", "105", "101", "103", "102"}, 6},
+		{"first page", Query{Sort: "id", Limit: 4}, []string{"101", "102", "103", "104"}, 6},
+		{"last page", Query{Sort: "id", Limit: 4, Offset: 4}, []string{"105", "106"}, 6},
+		{"past the end", Query{Offset: 10}, []string{}, 6},
+		{"filtered page", Query{City: "London", Sort: "id", Desc: true, Limit: 1}, []string{"103"}, 2},
+	} {
+		result, total, err := s.List(tc.q)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := ids(result); !reflect.DeepEqual(got, tc.ids) || total != tc.total {
+			t.Errorf("%s: got %v of %d, want %v of %d", tc.name, got, total, tc.ids, tc.total)
+		}
+	}
+
+	// ids are sorted as numbers, a deleted person is not listed
+	for _, id := range []string{"99", "1000"} {
+		if err := s.Create(testPerson(id, "Donald", "Knuth", "Stanford", "CA")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete("102", 0); err != nil {
+		t.Fatal(err)
+	}
+	result, total, err := s.List(Query{Sort: "id"})
+	want := []string{"99", "101", "103", "104", "105", "106", "1000"}
+	if err != nil || !reflect.DeepEqual(ids(result), want) || total != len(want) {
+		t.Fatalf("List sorted by id: got %v of %d, %v, want %v", ids(result), total, err, want)
+	}
+
+	// the versions are listed too
+	if _, err := s.Update(testPerson("101", "Ada", "King", "London", "LDN"), 1); err != nil {
+		t.Fatal(err)
+	}
+	result, _, err = s.List(Query{Lastname: "King"})
+	if err != nil || len(result) != 1 || result[0].Version != 2 {
+		t.Fatalf("List after Update: got %+v, %v", result, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		return &MemoryStore{people: map[string]Person{}}
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	var stores []*FileStore
+	defer func() {
+		for _, s := range stores {
+			s.Close()
+			os.RemoveAll(s.dir)
+		}
+	}()
+	testStore(t, func(t *testing.T) Store {
+		dir, err := ioutil.TempDir("", "filestore")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewFileStore(dir)
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+		stores = append(stores, s)
+		return s
+	})
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Create(testPerson("101", "Ada", "Lovelace", "London", "LDN"))
+	s.Create(testPerson("102", "Grace", "Hopper", "New York", "NY"))
+	s.Update(testPerson("101", "Ada", "King", "London", "LDN"), 1)
+	s.Delete("102", 0)
+	want, _, _ := s.List(Query{})
+	s.Close()
+
+	// the log is replayed, then compacted
+	for i := 0; i < 2; i++ {
+		s, err = NewFileStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, _ := s.List(Query{})
+		s.Close()
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("reopen %d: got %+v, want %+v", i, got, want)
+		}
+	}
+}
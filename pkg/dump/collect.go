@@ -0,0 +1,325 @@
+package dump
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	collectPageSize   = 500
+	// collectedList is the file of a kind directory listing the objects
+	// written by the last collection, the other files (e.g. uploads) are never pruned
+	collectedList = ".collected"
+)
+
+// kind is a resource the collector can list
+type kind struct {
+	// path of the resource in the API, e.g. /api/v1 or /apis/apps/v1
+	group    string
+	resource string
+	// dir the objects are written to, the lowercase kind, taken from the
+	// kind of the list when empty
+	dir        string
+	namespaced bool
+}
+
+// kinds are the resources known by their short name, other resources are
+// given as <group>/<version>/<resource> (or v1/<resource> for the core group),
+// namespaced unless prefixed with "cluster:", e.g. cluster:storage.k8s.io/v1/storageclasses
+var kinds = map[string]kind{
+	"nodes":                  {"/api/v1", "nodes", "node", false},
+	"namespaces":             {"/api/v1", "namespaces", "namespace", false},
+	"persistentvolumes":      {"/api/v1", "persistentvolumes", "persistentvolume", false},
+	"pods":                   {"/api/v1", "pods", "pod", true},
+	"events":                 {"/api/v1", "events", "event", true},
+	"services":               {"/api/v1", "services", "service", true},
+	"endpoints":              {"/api/v1", "endpoints", "endpoints", true},
+	"configmaps":             {"/api/v1", "configmaps", "configmap", true},
+	"persistentvolumeclaims": {"/api/v1", "persistentvolumeclaims", "persistentvolumeclaim", true},
+	"deployments":            {"/apis/apps/v1", "deployments", "deployment", true},
+	"daemonsets":             {"/apis/apps/v1", "daemonsets", "daemonset", true},
+	"statefulsets":           {"/apis/apps/v1", "statefulsets", "statefulset", true},
+	"replicasets":            {"/apis/apps/v1", "replicasets", "replicaset", true},
+	"jobs":                   {"/apis/batch/v1", "jobs", "job", true},
+}
+
+// parseKind returns the resource given by s, see kinds
+func parseKind(s string) (kind, error) {
+	if k, ok := kinds[s]; ok {
+		return k, nil
+	}
+	namespaced := true
+	if strings.HasPrefix(s, "cluster:") {
+		namespaced = false
+		s = strings.TrimPrefix(s, "cluster:")
+	}
+	parts := strings.Split(s, "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "v1":
+		return kind{"/api/v1", parts[1], "", namespaced}, nil
+	case len(parts) == 3:
+		return kind{"/apis/" + parts[0] + "/" + parts[1], parts[2], "", namespaced}, nil
+	}
+	return kind{}, fmt.Errorf("unknown kind %q, use one of the short names or <group>/<version>/<resource>", s)
+}
+
+// CollectorOptions configures the collector
+type CollectorOptions struct {
+	// Host is the url of the API server, in-cluster it is built from
+	// KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT
+	Host string
+	// TokenFile and CACert default to the files of the service account,
+	// a missing token file sends no token (e.g. for kubectl proxy)
+	TokenFile string
+	CACert    string
+	// Namespace restricts the namespaced kinds to a namespace, all namespaces if empty
+	Namespace string
+	Kinds     []string
+	Interval  time.Duration
+}
+
+// Collector writes the objects listed from the Kubernetes API into the dump
+// tree, as <kind>/<namespace>_<name>.json (<kind>/_<name>.json if cluster scoped)
+type Collector struct {
+	opts   CollectorOptions
+	kinds  []kind
+	client *http.Client
+}
+
+// NewCollector returns a Collector, the dump root must be set by Init first
+func NewCollector(opts CollectorOptions) (*Collector, error) {
+	if opts.Host == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a cluster, the API server must be set")
+		}
+		opts.Host = "https://" + strings.Join([]string{host, port}, ":")
+		if strings.Contains(host, ":") {
+			// IPv6
+			opts.Host = "https://[" + host + "]:" + port
+		}
+	}
+	if opts.TokenFile == "" {
+		opts.TokenFile = filepath.Join(serviceAccountDir, "token")
+	}
+	if opts.CACert == "" {
+		opts.CACert = filepath.Join(serviceAccountDir, "ca.crt")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Minute
+	}
+
+	c := &Collector{opts: opts, client: &http.Client{Timeout: time.Minute}}
+	for _, s := range opts.Kinds {
+		k, err := parseKind(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		c.kinds = append(c.kinds, k)
+	}
+
+	if strings.HasPrefix(opts.Host, "https://") {
+		config := &tls.Config{}
+		if pem, err := ioutil.ReadFile(opts.CACert); err == nil {
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", opts.CACert)
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		c.client.Transport = &http.Transport{TLSClientConfig: config, Proxy: http.ProxyFromEnvironment}
+	}
+	return c, nil
+}
+
+// Run collects the objects every interval until ctx is done
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		c.Collect(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Collect lists every kind once, a kind failing to be listed is logged and
+// its previous dump is kept
+func (c *Collector) Collect(ctx context.Context) {
+	for _, k := range c.kinds {
+		start := time.Now()
+		n, err := c.collect(ctx, k)
+		if err != nil {
+			log.Printf("Collector : ERROR : %s: %s\n", k.resource, err)
+			continue
+		}
+		log.Printf("Collector : collected %d %s in %v\n", n, k.resource, time.Since(start))
+	}
+}
+
+// objectList is the part of a list response the collector needs
+type objectList struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+	Items []map[string]interface{} `json:"items"`
+}
+
+// collect writes the objects of k and removes the objects which are gone
+func (c *Collector) collect(ctx context.Context, k kind) (int, error) {
+	p := k.group
+	if k.namespaced && c.opts.Namespace != "" {
+		p += "/namespaces/" + url.PathEscape(c.opts.Namespace)
+	}
+	p += "/" + k.resource
+
+	dir := k.dir
+	written := map[string]bool{}
+	next := ""
+	for {
+		v := url.Values{"limit": {fmt.Sprint(collectPageSize)}}
+		if next != "" {
+			v.Set("continue", next)
+		}
+		var l objectList
+		if err := c.get(ctx, p+"?"+v.Encode(), &l); err != nil {
+			return len(written), err
+		}
+		if dir == "" {
+			// e.g. storageclass for a StorageClassList
+			dir = strings.ToLower(strings.TrimSuffix(l.Kind, "List"))
+			if dir == "" || strings.ContainsAny(dir, "/\\.") {
+				return 0, fmt.Errorf("GET %s: unexpected kind %q", p, l.Kind)
+			}
+		}
+
+		for _, item := range l.Items {
+			// the items of a list have no kind of their own
+			item["apiVersion"] = l.APIVersion
+			item["kind"] = strings.TrimSuffix(l.Kind, "List")
+
+			meta, _ := item["metadata"].(map[string]interface{})
+			name, _ := meta["name"].(string)
+			namespace, _ := meta["namespace"].(string)
+			if name == "" || strings.ContainsAny(name+namespace, "/\\") {
+				continue
+			}
+			file := namespace + "_" + name + ".json"
+			if err := c.write(dir+"/"+file, item); err != nil {
+				return len(written), err
+			}
+			written[file] = true
+		}
+
+		next = l.Metadata.Continue
+		if next == "" {
+			break
+		}
+	}
+	return len(written), c.prune(dir, written)
+}
+
+// get decodes the response of the API server to the GET of p into v
+func (c *Collector) get(ctx context.Context, p string, v interface{}) error {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(c.opts.Host, "/")+p, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	// read the token on every request, projected tokens are rotated
+	if token, err := ioutil.ReadFile(c.opts.TokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GET %s: %s: %s", p, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Collector) write(rel string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	name, err := resolveNew(rel)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return replace(name, append(data, '\n'))
+}
+
+// prune removes the objects written by the previous collection of the kind
+// dir which were not written by the last one, then records the last ones
+func (c *Collector) prune(kindDir string, written map[string]bool) error {
+	listRel := kindDir + "/" + collectedList
+	name, err := resolve(listRel)
+	if os.IsNotExist(err) && len(written) == 0 {
+		// nothing collected yet, don't create the directory
+		return nil
+	}
+	if err == nil {
+		previous, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		for _, f := range strings.Split(string(previous), "\n") {
+			if f == "" || written[f] || filepath.Ext(f) != ".json" || strings.ContainsAny(f, "/\\") {
+				continue
+			}
+			obj, err := resolve(kindDir + "/" + f)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(obj); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	files := make([]string, 0, len(written))
+	for f := range written {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	name, err = resolveNew(listRel)
+	if err != nil {
+		return err
+	}
+	return replace(name, []byte(strings.Join(files, "\n")+"\n"))
+}
@@ -0,0 +1,279 @@
+package dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// fakeAPI serves the nodes, the pods of the default namespace and the
+// storage classes, a page at a time, the objects listed can be changed
+// between collections
+type fakeAPI struct {
+	mu             sync.Mutex
+	nodes          []string
+	pods           []string
+	storageClasses []string
+	// requests holds the url of every request
+	requests []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.URL.String())
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var names []string
+	var apiVersion, kind, namespace string
+	switch r.URL.Path {
+	case "/api/v1/nodes":
+		names, apiVersion, kind = f.nodes, "v1", "NodeList"
+	case "/api/v1/namespaces/default/pods":
+		names, apiVersion, kind, namespace = f.pods, "v1", "PodList", "default"
+	case "/apis/storage.k8s.io/v1/storageclasses":
+		names, apiVersion, kind = f.storageClasses, "storage.k8s.io/v1", "StorageClassList"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	// pages of 2 objects, the continue token is the index of the next one
+	start := 0
+	if c := r.URL.Query().Get("continue"); c != "" {
+		fmt.Sscan(c, &start)
+	}
+	end := start + 2
+	next := fmt.Sprint(end)
+	if end >= len(names) {
+		end, next = len(names), ""
+	}
+
+	items := []map[string]interface{}{}
+	for _, n := range names[start:end] {
+		meta := map[string]interface{}{"name": n}
+		if namespace != "" {
+			meta["namespace"] = namespace
+		}
+		items = append(items, map[string]interface{}{"metadata": meta, "spec": map[string]interface{}{}})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"continue": next},
+		"items":      items,
+	})
+}
+
+func (f *fakeAPI) set(nodes []string, pods []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nodes, f.pods = nodes, pods
+}
+
+// readObject reads a dumped object, nil if it does not exist
+func readObject(t *testing.T, root string, rel string) map[string]interface{} {
+	t.Helper()
+	raw, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		t.Fatalf("%s: %s", rel, err)
+	}
+	return obj
+}
+
+func TestCollect(t *testing.T) {
+	root, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := Init(root, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	token := filepath.Join(root, "..", filepath.Base(root)+".token")
+	if err := ioutil.WriteFile(token, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(token)
+
+	api := &fakeAPI{}
+	api.set([]string{"n-a", "n-b", "n-c"}, []string{"web-1"})
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	c, err := NewCollector(CollectorOptions{
+		Host:      srv.URL,
+		TokenFile: token,
+		Namespace: "default",
+		Kinds:     []string{"nodes", "pods"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an object uploaded next to the collected ones
+	req := httptest.NewRequest("POST", "/dump/node/_broken", strings.NewReader(`{"kind": "Node"}`))
+	req = mux.SetURLVars(req, map[string]string{"path": "node/_broken"})
+	rec := httptest.NewRecorder()
+	Upload(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload: got %d: %s", rec.Code, rec.Body)
+	}
+
+	c.Collect(context.Background())
+
+	continued := 0
+	for _, u := range api.requests {
+		if strings.Contains(u, "continue=") {
+			continued++
+		}
+	}
+	if continued != 1 {
+		t.Errorf("got %d requests with a continue token, want 1: %v", continued, api.requests)
+	}
+
+	for _, n := range []string{"n-a", "n-b", "n-c"} {
+		obj := readObject(t, root, "node/_"+n+".json")
+		if obj == nil {
+			t.Fatalf("node %s was not written", n)
+		}
+		if obj["kind"] != "Node" || obj["apiVersion"] != "v1" {
+			t.Errorf("node %s: got kind %v and apiVersion %v, want Node and v1", n, obj["kind"], obj["apiVersion"])
+		}
+	}
+	if obj := readObject(t, root, "pod/default_web-1.json"); obj == nil || obj["kind"] != "Pod" {
+		t.Errorf("pod default/web-1: got %v", obj)
+	}
+
+	// the objects gone from the API are pruned, the uploaded one is kept
+	api.set([]string{"n-a"}, nil)
+	c.Collect(context.Background())
+
+	for rel, want := range map[string]bool{
+		"node/_n-a.json":         true,
+		"node/_n-b.json":         false,
+		"node/_n-c.json":         false,
+		"node/_broken.json":      true,
+		"pod/default_web-1.json": false,
+		"node/" + collectedList:  true,
+		"pod/" + collectedList:   true,
+	} {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+		if got := err == nil; got != want {
+			t.Errorf("%s: exists %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestCollectUnauthorized(t *testing.T) {
+	root, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := Init(root, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	api := &fakeAPI{}
+	api.set([]string{"n-a"}, nil)
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	// no token file, no token sent
+	c, err := NewCollector(CollectorOptions{Host: srv.URL, TokenFile: filepath.Join(root, "missing"), Kinds: []string{"nodes"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.collect(context.Background(), kinds["nodes"]); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got %v, want a 401 error", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "node")); !os.IsNotExist(err) {
+		t.Errorf("node directory: got %v, want it not to exist", err)
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    kind
+		wantErr bool
+	}{
+		{"nodes", kinds["nodes"], false},
+		{"v1/secrets", kind{"/api/v1", "secrets", "", true}, false},
+		{"cluster:v1/componentstatuses", kind{"/api/v1", "componentstatuses", "", false}, false},
+		{"networking.k8s.io/v1/ingresses", kind{"/apis/networking.k8s.io/v1", "ingresses", "", true}, false},
+		{"cluster:storage.k8s.io/v1/storageclasses", kind{"/apis/storage.k8s.io/v1", "storageclasses", "", false}, false},
+		{"secrets", kind{}, true},
+		{"v2/secrets", kind{}, true},
+		{"a/b/c/d", kind{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseKind(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%q: got %+v, %v, want %+v", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestCollectCustomKind(t *testing.T) {
+	root, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := Init(root, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	token := filepath.Join(root, "..", filepath.Base(root)+".token")
+	if err := ioutil.WriteFile(token, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(token)
+
+	api := &fakeAPI{storageClasses: []string{"standard", "premium-rwo"}}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	c, err := NewCollector(CollectorOptions{Host: srv.URL, TokenFile: token, Kinds: []string{"cluster:storage.k8s.io/v1/storageclasses"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Collect(context.Background())
+
+	// the directory is the kind of the list, not the resource
+	for _, n := range []string{"standard", "premium-rwo"} {
+		obj := readObject(t, root, "storageclass/_"+n+".json")
+		if obj == nil || obj["kind"] != "StorageClass" || obj["apiVersion"] != "storage.k8s.io/v1" {
+			t.Errorf("storage class %s: got %v", n, obj)
+		}
+	}
+
+	api.mu.Lock()
+	api.storageClasses = []string{"standard"}
+	api.mu.Unlock()
+	c.Collect(context.Background())
+	if obj := readObject(t, root, "storageclass/_premium-rwo.json"); obj != nil {
+		t.Errorf("storage class premium-rwo: got %v, want it pruned", obj)
+	}
+}
@@ -0,0 +1,230 @@
+package dump
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultIgnore are the fields changing on every write of a kubernetes object
+var defaultIgnore = []string{"resourceVersion", "managedFields"}
+
+// listKeys identify the elements of a list, so e.g. the conditions are
+// compared by type rather than by position
+var listKeys = []string{"name", "type"}
+
+const (
+	diffAdded   = "added"
+	diffRemoved = "removed"
+	diffChanged = "changed"
+)
+
+// difference is a field which differs between two objects, the path can be
+// used as the path parameter of /dump/{path}
+type difference struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"`
+	A    interface{} `json:"a,omitempty"`
+	B    interface{} `json:"b,omitempty"`
+}
+
+// differ compares two objects
+type differ struct {
+	// ignore holds field names, or paths when starting with a dot
+	ignore      []string
+	differences []difference
+}
+
+func (d *differ) ignored(p string, key string) bool {
+	for _, i := range d.ignore {
+		if i == key || (strings.HasPrefix(i, ".") && (p == i || strings.HasPrefix(p, i+".") || strings.HasPrefix(p, i+"["))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *differ) add(p string, op string, a interface{}, b interface{}) {
+	if p == "" {
+		p = "."
+	}
+	d.differences = append(d.differences, difference{Path: p, Op: op, A: a, B: b})
+}
+
+func (d *differ) compare(p string, a interface{}, b interface{}) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			d.compareMaps(p, a, b)
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			d.compareLists(p, a, b)
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		d.add(p, diffChanged, a, b)
+	}
+}
+
+func (d *differ) compareMaps(p string, a map[string]interface{}, b map[string]interface{}) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		kp := fieldPath(p, k)
+		if d.ignored(kp, k) {
+			continue
+		}
+		va, inA := a[k]
+		vb, inB := b[k]
+		switch {
+		case !inB:
+			d.add(kp, diffRemoved, va, nil)
+		case !inA:
+			d.add(kp, diffAdded, nil, vb)
+		default:
+			d.compare(kp, va, vb)
+		}
+	}
+}
+
+// fieldPath returns the path of the field k of the object at p
+func fieldPath(p string, k string) string {
+	if strings.ContainsAny(k, ".[]'") {
+		return p + "['" + k + "']"
+	}
+	return p + "." + k
+}
+
+// listKey returns the field identifying every element of both lists, if any
+func listKey(a []interface{}, b []interface{}) string {
+	for _, key := range listKeys {
+		seen := map[string]bool{}
+		ok := true
+		for _, l := range [][]interface{}{a, b} {
+			ids := map[string]bool{}
+			for _, e := range l {
+				m, isMap := e.(map[string]interface{})
+				id, isString := m[key].(string)
+				if !isMap || !isString || ids[id] {
+					ok = false
+					break
+				}
+				ids[id] = true
+				seen[id] = true
+			}
+		}
+		if ok && len(seen) > 0 {
+			return key
+		}
+	}
+	return ""
+}
+
+func (d *differ) compareLists(p string, a []interface{}, b []interface{}) {
+	key := listKey(a, b)
+	if key == "" {
+		for i := 0; i < len(a) || i < len(b); i++ {
+			ip := p + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(b):
+				d.add(ip, diffRemoved, a[i], nil)
+			case i >= len(a):
+				d.add(ip, diffAdded, nil, b[i])
+			default:
+				d.compare(ip, a[i], b[i])
+			}
+		}
+		return
+	}
+
+	elem := func(e interface{}) (string, string) {
+		id := e.(map[string]interface{})[key].(string)
+		return id, fmt.Sprintf("%s[?(@.%s==%q)]", p, key, id)
+	}
+	inB := map[string]interface{}{}
+	for _, e := range b {
+		id, _ := elem(e)
+		inB[id] = e
+	}
+	inA := map[string]bool{}
+	for _, e := range a {
+		id, ep := elem(e)
+		inA[id] = true
+		if eb, ok := inB[id]; ok {
+			d.compare(ep, e, eb)
+		} else {
+			d.add(ep, diffRemoved, e, nil)
+		}
+	}
+	for _, e := range b {
+		if id, ep := elem(e); !inA[id] {
+			d.add(ep, diffAdded, nil, e)
+		}
+	}
+}
+
+// Diff compares two dumped objects, it returns the fields added, removed
+// or changed from a to b, ignoring the given fields (names, or paths
+// starting with a dot, default: resourceVersion,managedFields)
+// example: curl '/dump/diff?a=node/healthy&b=node/broken&ignore=resourceVersion,managedFields,.status.conditions'
+func Diff(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	format, err := outputFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if params.Get("a") == "" || params.Get("b") == "" {
+		http.Error(w, "a and b are required", http.StatusBadRequest)
+		return
+	}
+
+	objects := map[string]interface{}{}
+	for _, k := range []string{"a", "b"} {
+		rel := strings.TrimPrefix(path.Clean("/"+params.Get(k)), "/")
+		data, err := load(rel)
+		if err != nil {
+			writeError(w, rel, err)
+			return
+		}
+		objects[k] = data
+	}
+
+	d := &differ{ignore: defaultIgnore}
+	if v, ok := params["ignore"]; ok {
+		// an empty ignore compares every field
+		d.ignore = nil
+		for _, f := range strings.Split(strings.Join(v, ","), ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				d.ignore = append(d.ignore, f)
+			}
+		}
+	}
+	d.compare("", objects["a"], objects["b"])
+
+	if d.differences == nil {
+		d.differences = []difference{}
+	}
+	encode(w, format, map[string]interface{}{
+		"a":           params.Get("a"),
+		"b":           params.Get("b"),
+		"equal":       len(d.differences) == 0,
+		"differences": d.differences,
+	})
+}
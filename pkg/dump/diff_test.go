@@ -0,0 +1,160 @@
+package dump
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name   string
+		a      string
+		b      string
+		ignore []string
+		want   []difference
+	}{
+		{"equal", `{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1}`, nil, nil},
+		{"root", `1`, `2`, nil, []difference{{".", diffChanged, 1.0, 2.0}}},
+		{
+			"fields",
+			`{"kept":1,"changed":"x","removed":true,"nested":{"v":1}}`,
+			`{"kept":1,"changed":"y","added":null,"nested":{"v":2}}`,
+			nil,
+			[]difference{
+				{".added", diffAdded, nil, nil},
+				{".changed", diffChanged, "x", "y"},
+				{".nested.v", diffChanged, 1.0, 2.0},
+				{".removed", diffRemoved, true, nil},
+			},
+		},
+		{"type change", `{"v":{"x":1}}`, `{"v":[1]}`, nil, []difference{{".v", diffChanged, map[string]interface{}{"x": 1.0}, []interface{}{1.0}}}},
+		{"quoted keys", `{"labels":{"a.b/c":"x"}}`, `{"labels":{"a.b/c":"y"}}`, nil, []difference{{".labels['a.b/c']", diffChanged, "x", "y"}}},
+		{
+			"lists by position",
+			`{"args":["a","b","c"]}`,
+			`{"args":["a","x"]}`,
+			nil,
+			[]difference{{".args[1]", diffChanged, "b", "x"}, {".args[2]", diffRemoved, "c", nil}},
+		},
+		{
+			"lists by type",
+			`{"conditions":[{"type":"Ready","status":"True"},{"type":"DiskPressure","status":"False"}]}`,
+			`{"conditions":[{"type":"DiskPressure","status":"True"},{"type":"PIDPressure","status":"False"}]}`,
+			nil,
+			[]difference{
+				{`.conditions[?(@.type=="Ready")]`, diffRemoved, map[string]interface{}{"type": "Ready", "status": "True"}, nil},
+				{`.conditions[?(@.type=="DiskPressure")].status`, diffChanged, "False", "True"},
+				{`.conditions[?(@.type=="PIDPressure")]`, diffAdded, nil, map[string]interface{}{"type": "PIDPressure", "status": "False"}},
+			},
+		},
+		{
+			// name wins over type
+			"lists by name",
+			`{"containers":[{"name":"app","type":"x","image":"v1"},{"name":"sidecar","type":"x","image":"v1"}]}`,
+			`{"containers":[{"name":"sidecar","type":"x","image":"v1"},{"name":"app","type":"x","image":"v2"}]}`,
+			nil,
+			[]difference{{`.containers[?(@.name=="app")].image`, diffChanged, "v1", "v2"}},
+		},
+		{
+			// the names are not unique, the elements are compared by position
+			"lists with duplicate keys",
+			`{"l":[{"name":"a","v":1},{"name":"a","v":2}]}`,
+			`{"l":[{"name":"a","v":2},{"name":"a","v":2}]}`,
+			nil,
+			[]difference{{".l[0].v", diffChanged, 1.0, 2.0}},
+		},
+		{
+			"ignored",
+			`{"metadata":{"resourceVersion":"1","managedFields":[1]},"status":{"phase":"Running","ready":true},"statusText":"a"}`,
+			`{"metadata":{"resourceVersion":"2","managedFields":[2]},"status":{"phase":"Failed","ready":false},"statusText":"b"}`,
+			[]string{"resourceVersion", "managedFields", ".status"},
+			[]difference{{".statusText", diffChanged, "a", "b"}},
+		},
+		{
+			"ignored path in a list",
+			`{"conditions":[{"type":"Ready","status":"True","lastHeartbeatTime":"1"}]}`,
+			`{"conditions":[{"type":"Ready","status":"True","lastHeartbeatTime":"2"}]}`,
+			[]string{"lastHeartbeatTime"},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		var a, b interface{}
+		if err := json.Unmarshal([]byte(tt.a), &a); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tt.b), &b); err != nil {
+			t.Fatal(err)
+		}
+		d := &differ{ignore: tt.ignore}
+		d.compare("", a, b)
+		if !reflect.DeepEqual(d.differences, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, d.differences, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	root, done := testDump(t)
+	defer done()
+	if err := Init(root, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"healthy.json": `{"metadata":{"name":"node-1","resourceVersion":"1"},"status":{"conditions":[{"type":"Ready","status":"True"}]}}`,
+		"broken.yaml":  "metadata:\n  name: node-1\n  resourceVersion: \"2\"\nstatus:\n  conditions:\n  - type: Ready\n    status: \"False\"\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, "node", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diff := func(query string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		Diff(w, httptest.NewRequest("GET", "/dump/diff?"+query, nil))
+		var out map[string]interface{}
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+		}
+		return w.Code, out
+	}
+
+	// a JSON and a YAML object, the resourceVersion is ignored by default
+	status, out := diff("a=node/healthy&b=node/broken")
+	want := []interface{}{map[string]interface{}{
+		"path": `.status.conditions[?(@.type=="Ready")].status`, "op": diffChanged, "a": "True", "b": "False",
+	}}
+	if status != http.StatusOK || out["equal"] != false || !reflect.DeepEqual(out["differences"], want) {
+		t.Fatalf("got %d %+v", status, out)
+	}
+	// an empty ignore compares every field
+	if _, out := diff("a=node/healthy&b=node/broken&ignore="); len(out["differences"].([]interface{})) != 2 {
+		t.Fatalf("ignore nothing: got %+v", out)
+	}
+	if _, out := diff("a=node/healthy&b=node/healthy.json"); out["equal"] != true || len(out["differences"].([]interface{})) != 0 {
+		t.Fatalf("equal: got %+v", out)
+	}
+
+	for _, tt := range []struct {
+		query  string
+		status int
+	}{
+		{"a=node/healthy", http.StatusBadRequest},
+		{"a=node/healthy&b=node/missing", http.StatusNotFound},
+		{"a=node&b=node/healthy", http.StatusBadRequest},
+		{"a=escape&b=node/healthy", http.StatusForbidden},
+		{"a=node/healthy&b=node/broken&format=xml", http.StatusBadRequest},
+	} {
+		if status, _ := diff(tt.query); status != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.query, status, tt.status)
+		}
+	}
+}
@@ -1,54 +1,313 @@
 package dump
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-var dir = "/data"
+var (
+	dir           = "/data"
+	maxSize int64 = 10 << 20
+)
 
-// GetObj ...
-func GetObj(w http.ResponseWriter, r *http.Request) {
+var (
+	// errOutside is returned for the paths resolving outside of the dump root
+	errOutside = errors.New("path is outside of the dump root")
+	// errTooLarge is returned for the files larger than maxSize
+	errTooLarge = errors.New("file is too large")
+	// errIsDir is returned when an object is expected
+	errIsDir = errors.New("is a directory")
+)
+
+// Init sets the dump root and the max size of the objects served
+func Init(root string, max int64) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	// the root itself may be a symlink (e.g. a mounted ConfigMap)
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	dir = abs
+	maxSize = max
+	return nil
+}
+
+// resolve returns the file behind rel, symlinks included, making sure it
+// is in the dump root
+func resolve(rel string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	// cleaning a rooted path drops any leading ..
+	name := filepath.Join(root, filepath.Clean("/"+filepath.FromSlash(rel)))
+	resolved, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return "", err
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", errOutside
+	}
+	return resolved, nil
+}
+
+// readFile reads the file at name, up to maxSize bytes
+func readFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	raw, err := ioutil.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > maxSize {
+		return nil, errTooLarge
+	}
+	return raw, nil
+}
+
+// lookup resolves the dumped file or directory at rel, the extension of an
+// object may be left out, it returns rel with the extension found and the
+// resolved file
+func lookup(rel string) (string, string, error) {
+	file := rel
+	name, err := resolve(file)
+	if os.IsNotExist(err) && !isObject(rel) {
+		for _, ext := range extensions {
+			file = rel + ext
+			if name, err = resolve(file); !os.IsNotExist(err) {
+				break
+			}
+		}
+	}
+	return file, name, err
+}
 
-	params := mux.Vars(r)
-	name := params["name"]
+// read reads and parses the object file resolved to name
+func read(file string, name string) (interface{}, error) {
+	raw, err := readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decode(file, raw)
+	if err != nil {
+		return nil, &parseError{file: file, err: err}
+	}
+	return data, nil
+}
 
-	// /data/node/_gke-rei-default-pool-d3692fcf-3svd.json
-	raw, err := ioutil.ReadFile(filepath.Join(dir, name+".json"))
+// load reads and parses the dumped object at rel
+func load(rel string) (interface{}, error) {
+	file, name, err := lookup(rel)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(name)
 	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, errIsDir
+	}
+	return read(file, name)
+}
+
+// parseError is returned for the objects which can't be parsed
+type parseError struct {
+	file string
+	err  error
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("failed to parse %s: %s", e.file, e.err)
+}
+
+// writeError maps the errors of resolve and readFile to a response
+func writeError(w http.ResponseWriter, rel string, err error) {
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, "404 - "+rel+" not found", http.StatusNotFound)
+	case err == errOutside, os.IsPermission(err):
+		http.Error(w, "403 - "+rel+" is forbidden", http.StatusForbidden)
+	case err == errIsDir:
+		http.Error(w, "400 - "+rel+" is a directory", http.StatusBadRequest)
+	case err == errQuota:
+		http.Error(w, fmt.Sprintf("507 - %s would exceed the quota of %d bytes in %d files", rel, maxTotalSize, maxFiles), http.StatusInsufficientStorage)
+	case err == errTooLarge:
+		http.Error(w, fmt.Sprintf("413 - %s is larger than %d bytes", rel, maxSize), http.StatusRequestEntityTooLarge)
+	default:
+		if _, ok := err.(*parseError); ok {
+			http.Error(w, "500 - "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		log.Print(err)
-		return
 	}
+}
+
+// entry is a file or a directory in a listing
+type entry struct {
+	Name  string
+	Link  string
+	Dir   bool
+	Size  int64
+	MTime time.Time
+}
+
+// crumb is a parent directory in the breadcrumbs of a listing
+type crumb struct {
+	Name string
+	Link string
+}
+
+var listTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>/dump/{{.Path}}</title></head>
+<body>
+<p>{{range $i, $c := .Crumbs}}{{if $i}} / {{end}}<a href="{{$c.Link}}">{{$c.Name}}</a>{{end}}</p>
+<p><input id="filter" type="search" placeholder="filter names" size="40" autofocus></p>
+<form action="/dump/search">
+<input type="hidden" name="dir" value="{{.Path}}"><input type="hidden" name="format" value="html">
+<input name="q" placeholder="value" required> <input name="path" placeholder="path (optional), e.g. .spec.nodeName" size="40">
+<button>search</button>
+</form>
+<table id="entries">
+<tr><th align="left">Name</th><th align="right">Size</th><th align="left">Modified</th></tr>
+{{range .Entries}}<tr><td><a href="{{.Link}}">{{.Name}}{{if .Dir}}/{{end}}</a></td><td align="right">{{if not .Dir}}{{.Size}}{{end}}</td><td>{{.MTime.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+<script>
+document.getElementById("filter").addEventListener("input", function (e) {
+	var q = e.target.value.trim().toLowerCase();
+	var rows = document.getElementById("entries").rows;
+	for (var i = 1; i < rows.length; i++) {
+		rows[i].style.display = rows[i].cells[0].textContent.toLowerCase().indexOf(q) >= 0 ? "" : "none";
+	}
+});
+</script>
+</body>
+</html>
+`))
+
+// link returns the url of the dumped file or directory at rel
+func link(rel string) string {
+	return (&url.URL{Path: path.Join("/dump", rel)}).EscapedPath()
+}
 
-	var data map[string]interface{}
-	_ = json.Unmarshal(raw, &data)
+// GetObj serves a dumped object (JSON or YAML) as JSON, YAML or pretty JSON
+// (format=json|yaml|pretty or the Accept header), or lists the directory at path,
+// path=<JSONPath or dotted path> only returns a part of the object
+// e.g. /dump/node/_gke-rei-default-pool-d3692fcf-3svd serves /data/node/_gke-rei-default-pool-d3692fcf-3svd.json
+// e.g. /dump/node/_gke-rei-default-pool-d3692fcf-3svd?path=.status.conditions
+func GetObj(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(path.Clean("/"+mux.Vars(r)["path"]), "/")
+	format, err := outputFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var steps []step
+	if p := r.URL.Query().Get("path"); p != "" {
+		if steps, err = parsePath(p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	file, name, err := lookup(rel)
+	if err != nil {
+		writeError(w, rel, err)
+		return
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		writeError(w, rel, err)
+		return
+	}
+	if fi.IsDir() {
+		list(w, r, rel)
+		return
+	}
 
-	json.NewEncoder(w).Encode(data)
+	data, err := read(file, name)
+	if err != nil {
+		writeError(w, rel, err)
+		return
+	}
+	if steps != nil {
+		var ok bool
+		if data, ok = selectPath(steps, data); !ok {
+			http.Error(w, fmt.Sprintf("404 - %s not found in %s", r.URL.Query().Get("path"), rel), http.StatusNotFound)
+			return
+		}
+	}
+	if format == formatHTML && steps == nil {
+		view(w, rel, data, related(data))
+		return
+	}
+	encode(w, format, data)
 }
 
-// GetAll ...
+// GetAll lists the dump root
 func GetAll(w http.ResponseWriter, r *http.Request) {
+	list(w, r, "")
+}
 
-	files, err := ioutil.ReadDir(dir)
+// list writes the entries of the directory at rel (relative to the dump root)
+func list(w http.ResponseWriter, r *http.Request, rel string) {
+	name, err := resolve(rel)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		log.Print(err)
+		writeError(w, rel, err)
+		return
+	}
+	files, err := ioutil.ReadDir(name)
+	if err != nil {
+		writeError(w, rel, err)
 		return
 	}
 
+	var entries []entry
 	for _, file := range files {
-		n := strings.TrimSuffix(file.Name(), ".json")
-		fmt.Fprintf(w, "<a href=\"/kubedump/"+n+"\">"+n+"</a><br/>")
+		e := entry{
+			Name:  file.Name(),
+			Link:  link(path.Join(rel, file.Name())),
+			Dir:   file.IsDir(),
+			Size:  file.Size(),
+			MTime: file.ModTime(),
+		}
+		if e.Dir {
+			e.Link += "/"
+		} else if isObject(e.Name) {
+			// objects are served without the extension
+			e.Link = strings.TrimSuffix(e.Link, path.Ext(e.Link))
+		}
+		entries = append(entries, e)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = listTemplate.Execute(w, map[string]interface{}{
+		"Path":    rel,
+		"Crumbs":  crumbs(rel, true),
+		"Entries": entries,
+	})
+	if err != nil {
+		log.Print(err)
 	}
 }
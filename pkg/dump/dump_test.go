@@ -0,0 +1,168 @@
+package dump
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// testDump makes a dump root with a few objects next to a directory outside
+// of it, the root is set as the dump root
+func testDump(t *testing.T) (string, func()) {
+	tmp, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+	for _, d := range []string{filepath.Join(root, "node"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(root, "node", "a.json"):    `{"kind":"Node"}`,
+		filepath.Join(root, "big.json"):          `{"data":"` + string(make([]byte, 64)) + `"}`,
+		filepath.Join(outside, "secret.json"):    `{"secret":true}`,
+		filepath.Join(root, "not-an-object.txt"): "text",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		// a file and a directory escaping the root
+		filepath.Join(root, "escape.json"): filepath.Join(outside, "secret.json"),
+		filepath.Join(root, "linked"):      outside,
+		// a directory staying in it
+		filepath.Join(root, "nodes"): filepath.Join(root, "node"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Init(root, 32); err != nil {
+		t.Fatal(err)
+	}
+	return root, func() { os.RemoveAll(tmp) }
+}
+
+func TestResolve(t *testing.T) {
+	root, done := testDump(t)
+	defer done()
+	root, _ = filepath.EvalSymlinks(root)
+
+	tests := []struct {
+		rel  string
+		want string
+		err  func(error) bool
+	}{
+		{"", root, nil},
+		{"node/a.json", filepath.Join(root, "node", "a.json"), nil},
+		{"nodes/a.json", filepath.Join(root, "node", "a.json"), nil},
+		{"node/../node/a.json", filepath.Join(root, "node", "a.json"), nil},
+		// .. stops at the root
+		{"../outside/secret.json", "", os.IsNotExist},
+		{"../../node/a.json", filepath.Join(root, "node", "a.json"), nil},
+		// absolute paths are taken from the root
+		{"/node/a.json", filepath.Join(root, "node", "a.json"), nil},
+		{"/etc/passwd", "", os.IsNotExist},
+		{"escape.json", "", isOutside},
+		{"linked/secret.json", "", isOutside},
+		{"linked", "", isOutside},
+		{"missing.json", "", os.IsNotExist},
+	}
+	for _, tt := range tests {
+		got, err := resolve(tt.rel)
+		if tt.err != nil {
+			if !tt.err(err) {
+				t.Errorf("%q: got %q, %v", tt.rel, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.rel, got, err, tt.want)
+		}
+	}
+}
+
+func isOutside(err error) bool {
+	return err == errOutside
+}
+
+func TestGetObj(t *testing.T) {
+	_, done := testDump(t)
+	defer done()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"node/a", http.StatusOK},
+		{"node/a.json", http.StatusOK},
+		{"nodes/a", http.StatusOK},
+		{"node", http.StatusOK},
+		{"node/missing", http.StatusNotFound},
+		{"../outside/secret", http.StatusNotFound},
+		{"/etc/passwd", http.StatusNotFound},
+		{"escape", http.StatusForbidden},
+		{"linked/secret", http.StatusForbidden},
+		{"linked", http.StatusForbidden},
+		{"big", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		r := mux.SetURLVars(httptest.NewRequest("GET", "/dump/", nil), map[string]string{"path": tt.path})
+		w := httptest.NewRecorder()
+		GetObj(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%q: got status %d, want %d (%s)", tt.path, w.Code, tt.status, w.Body)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	root, done := testDump(t)
+	defer done()
+	root, _ = filepath.EvalSymlinks(root)
+	for _, name := range []string{"both.json", "both.yaml", "yaml.yaml", "yaml.yml", "yml.yml"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		rel  string
+		file string
+		err  func(error) bool
+	}{
+		// the extension is looked up as .json, .yaml then .yml
+		{"both", "both.json", nil},
+		{"yaml", "yaml.yaml", nil},
+		{"yml", "yml.yml", nil},
+		{"both.yaml", "both.yaml", nil},
+		{"node", "node", nil},
+		{"node/a", "node/a.json", nil},
+		{"missing", "", os.IsNotExist},
+		{"missing.json", "", os.IsNotExist},
+		{"escape", "", isOutside},
+	}
+	for _, tt := range tests {
+		file, name, err := lookup(tt.rel)
+		if tt.err != nil {
+			if !tt.err(err) {
+				t.Errorf("%q: got %q, %v", tt.rel, file, err)
+			}
+			continue
+		}
+		if err != nil || file != tt.file || name != filepath.Join(root, filepath.FromSlash(tt.file)) {
+			t.Errorf("%q: got %q %q, %v, want %q", tt.rel, file, name, err, tt.file)
+		}
+	}
+}
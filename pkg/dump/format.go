@@ -0,0 +1,142 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// extensions of the dumped objects, in the order they are looked up
+var extensions = []string{".json", ".yaml", ".yml"}
+
+const (
+	formatJSON   = "json"
+	formatYAML   = "yaml"
+	formatPretty = "pretty"
+	formatHTML   = "html"
+)
+
+// isObject tells whether name is a dumped object
+func isObject(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// decode parses a dumped object according to the extension of name, a
+// YAML file with several documents is returned as a list
+func decode(name string, raw []byte) (interface{}, error) {
+	if strings.ToLower(filepath.Ext(name)) == ".json" {
+		var data interface{}
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	var docs []interface{}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	for {
+		var doc interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, convert(doc))
+		}
+	}
+	if len(docs) == 1 {
+		return docs[0], nil
+	}
+	return docs, nil
+}
+
+// convert turns the map[interface{}]interface{} decoded by yaml into
+// map[string]interface{} so it can be encoded as JSON
+func convert(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = convert(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convert(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// outputFormat returns the format asked for by the format parameter or the
+// Accept header, json by default, html for browsers
+func outputFormat(r *http.Request) (string, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		switch f {
+		case formatJSON, formatYAML, formatPretty, formatHTML:
+			return f, nil
+		}
+		return "", fmt.Errorf("unsupported format %q, use json, yaml, pretty or html", f)
+	}
+	for i, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		t, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		switch t {
+		case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+			return formatYAML, nil
+		case "application/json":
+			return formatJSON, nil
+		case "text/html":
+			// only when preferred, as browsers do
+			if i == 0 {
+				return formatHTML, nil
+			}
+		}
+	}
+	return formatJSON, nil
+}
+
+// encode writes data in the given format
+func encode(w http.ResponseWriter, format string, data interface{}) {
+	switch format {
+	case formatHTML:
+		view(w, "", data, nil)
+	case formatYAML:
+		out, err := yaml.Marshal(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(out)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		if format == formatPretty {
+			enc.SetIndent("", "  ")
+		}
+		enc.Encode(data)
+	}
+}
@@ -0,0 +1,122 @@
+package dump
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		query   string
+		accept  string
+		want    string
+		wantErr bool
+	}{
+		{"", "", formatJSON, false},
+		{"", "*/*", formatJSON, false},
+		{"", "application/yaml", formatYAML, false},
+		{"", "application/x-yaml;q=0.9", formatYAML, false},
+		{"", "text/html,application/xhtml+xml,*/*;q=0.8", formatHTML, false},
+		{"format=html", "", formatHTML, false},
+		{"", "application/json, application/yaml", formatJSON, false},
+		{"format=pretty", "application/yaml", formatPretty, false},
+		{"format=yaml", "", formatYAML, false},
+		{"format=json", "application/yaml", formatJSON, false},
+		{"format=xml", "", "", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/dump/x?"+tt.query, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		got, err := outputFormat(r)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%q, Accept %q: got %q, %v, want %q", tt.query, tt.accept, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want interface{}
+	}{
+		{"a.json", `{"kind":"Node","spec":{"count":1}}`, map[string]interface{}{"kind": "Node", "spec": map[string]interface{}{"count": 1.0}}},
+		{"a.yaml", "kind: Node\nspec:\n  count: 1\n", map[string]interface{}{"kind": "Node", "spec": map[string]interface{}{"count": 1}}},
+		{"a.YML", "- a\n- b\n", []interface{}{"a", "b"}},
+		// several documents are a list
+		{"a.yaml", "kind: Node\n---\nkind: Pod\n---\n", []interface{}{map[string]interface{}{"kind": "Node"}, map[string]interface{}{"kind": "Pod"}}},
+	}
+	for _, tt := range tests {
+		got, err := decode(tt.name, []byte(tt.raw))
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: got %#v, %v", tt.name, tt.raw, got, err)
+		}
+	}
+	if _, err := decode("a.json", []byte("kind: Node")); err == nil {
+		t.Errorf("YAML in a .json file: got no error")
+	}
+}
+
+func TestGetObjFormats(t *testing.T) {
+	root, done := testDump(t)
+	defer done()
+	if err := Init(root, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	// the objects are looked up as .json, .yaml then .yml
+	files := map[string]string{
+		"both.json": `{"from":"json"}`,
+		"both.yaml": "from: yaml\n",
+		"yaml.yaml": "from: yaml\n",
+		"yaml.yml":  "from: yml\n",
+		"yml.yml":   "from: yml\n",
+		"bad.yaml":  "from: [\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, want := range map[string]string{"both": "json", "yaml": "yaml", "yml": "yml", "both.yaml": "yaml"} {
+		w := getObj(path, "", "")
+		var obj map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&obj); err != nil || obj["from"] != want {
+			t.Errorf("%s: got %d %v, %v, want from %s", path, w.Code, obj, err, want)
+		}
+	}
+
+	w := getObj("yml", "", "application/yaml")
+	var obj map[string]string
+	if err := yaml.Unmarshal(w.Body.Bytes(), &obj); err != nil || obj["from"] != "yml" || w.Header().Get("Content-Type") != "application/yaml" {
+		t.Errorf("yaml output: got %q, %v, Content-Type %q", w.Body, err, w.Header().Get("Content-Type"))
+	}
+	if w := getObj("both", "format=pretty", ""); w.Code != http.StatusOK || w.Body.String() != "{\n  \"from\": \"json\"\n}\n" {
+		t.Errorf("pretty output: got %d %q", w.Code, w.Body)
+	}
+	if w := getObj("bad", "", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("invalid yaml: got status %d", w.Code)
+	}
+}
+
+// getObj serves the object at path with the given query and Accept header
+func getObj(path string, query string, accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/dump/"+path+"?"+query, nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	r = mux.SetURLVars(r, map[string]string{"path": path})
+	w := httptest.NewRecorder()
+	GetObj(w, r)
+	return w
+}
@@ -0,0 +1,365 @@
+package dump
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxSearchResults = 1000
+
+// step is an element of a path: a field, an index, a wildcard or a filter
+type step struct {
+	field    string
+	index    int
+	wildcard bool
+	// filter keeps the elements whose field (a dotted path) compares to value
+	filter *filter
+}
+
+type filter struct {
+	field []step
+	op    string
+	value string
+}
+
+// parsePath parses a JSONPath subset or a dotted path, e.g.
+// .status.conditions, status.conditions[0].type, $.items[*].metadata.name,
+// {.status.conditions[?(@.type=="DiskPressure")].status}
+func parsePath(p string) ([]step, error) {
+	p = strings.TrimSpace(p)
+	if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+		// kubectl -o jsonpath style
+		p = p[1 : len(p)-1]
+	}
+	p = strings.TrimPrefix(p, "$")
+
+	var steps []step
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			i++
+		case '[':
+			end := closing(p, i)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in %q", p)
+			}
+			s, err := parseBracket(p[i+1 : end])
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+			i = end + 1
+		default:
+			j := i
+			for j < len(p) && p[j] != '.' && p[j] != '[' {
+				j++
+			}
+			name := p[i:j]
+			if name == "*" {
+				steps = append(steps, step{wildcard: true})
+			} else {
+				steps = append(steps, step{field: name})
+			}
+			i = j
+		}
+	}
+	return steps, nil
+}
+
+// closing returns the position of the ] closing the [ at start, ignoring quoted brackets
+func closing(p string, start int) int {
+	var quote byte
+	depth := 0
+	for i := start; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseBracket(s string) (step, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "*":
+		return step{wildcard: true}, nil
+	case strings.HasPrefix(s, "?(") && strings.HasSuffix(s, ")"):
+		f, err := parseFilter(s[2 : len(s)-1])
+		if err != nil {
+			return step{}, err
+		}
+		return step{filter: f}, nil
+	case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+		if len(s) == 2 {
+			return step{}, errors.New("empty field name in []")
+		}
+		return step{field: s[1 : len(s)-1]}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return step{}, fmt.Errorf("invalid index %q", s)
+	}
+	return step{index: n}, nil
+}
+
+// parseFilter parses @.field==value or @.field!=value, the value may be quoted
+func parseFilter(s string) (*filter, error) {
+	for _, op := range []string{"==", "!="} {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+		left := strings.TrimSpace(s[:i])
+		if !strings.HasPrefix(left, "@") {
+			return nil, fmt.Errorf("invalid filter %q, use @.field==value", s)
+		}
+		field, err := parsePath(left[1:])
+		if err != nil {
+			return nil, err
+		}
+		value := strings.TrimSpace(s[i+len(op):])
+		if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		return &filter{field: field, op: op, value: value}, nil
+	}
+	return nil, fmt.Errorf("invalid filter %q, use @.field==value", s)
+}
+
+// multi tells whether the path may select several values
+func multi(steps []step) bool {
+	for _, s := range steps {
+		if s.wildcard || s.filter != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// eval returns the values selected by steps in data
+func eval(data interface{}, steps []step) []interface{} {
+	values := []interface{}{data}
+	for _, s := range steps {
+		var next []interface{}
+		for _, v := range values {
+			next = append(next, s.apply(v)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func (s step) apply(v interface{}) []interface{} {
+	switch {
+	case s.wildcard:
+		return children(v)
+	case s.filter != nil:
+		var out []interface{}
+		for _, c := range children(v) {
+			if s.filter.match(c) {
+				out = append(out, c)
+			}
+		}
+		return out
+	case s.field != "":
+		if m, ok := v.(map[string]interface{}); ok {
+			if c, ok := m[s.field]; ok {
+				return []interface{}{c}
+			}
+		}
+		return nil
+	default:
+		l, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		i := s.index
+		if i < 0 {
+			i += len(l)
+		}
+		if i < 0 || i >= len(l) {
+			return nil
+		}
+		return []interface{}{l[i]}
+	}
+}
+
+// children returns the elements of a list or the values of a map (sorted by key)
+func children(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]interface{}, 0, len(v))
+		for _, k := range keys {
+			out = append(out, v[k])
+		}
+		return out
+	}
+	return nil
+}
+
+func (f *filter) match(v interface{}) bool {
+	found := false
+	for _, c := range eval(v, f.field) {
+		if scalar(c) && fmt.Sprint(c) == f.value {
+			found = true
+			break
+		}
+	}
+	if f.op == "!=" {
+		return !found
+	}
+	return found
+}
+
+func scalar(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// contains tells whether v or any value nested in v equals q
+func contains(v interface{}, q string) bool {
+	if scalar(v) {
+		return v != nil && fmt.Sprint(v) == q
+	}
+	for _, c := range children(v) {
+		if contains(c, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// errSearchLimit stops a search once enough results were found
+var errSearchLimit = errors.New("too many results")
+
+// searchResult is a dumped object matching a search
+type searchResult struct {
+	Path string `json:"path"`
+	Link string `json:"link"`
+}
+
+// Search finds the dumped objects with a value equal to q, optionally only
+// looking at the fields selected by path, in the directory dir (default: the
+// root). The search stops at maxSearchResults objects, X-Truncated is set then
+// example: curl '/dump/search?dir=node&path=.status.conditions[?(@.type=="DiskPressure")].status&q=True'
+func Search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := params.Get("q")
+	if q == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	var steps []step
+	if p := params.Get("path"); p != "" {
+		var err error
+		if steps, err = parsePath(p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	format, err := outputFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rel := strings.TrimPrefix(path.Clean("/"+params.Get("dir")), "/")
+	start, err := resolve(rel)
+	if err != nil {
+		writeError(w, rel, err)
+		return
+	}
+	root, err := resolve("")
+	if err != nil {
+		writeError(w, "", err)
+		return
+	}
+
+	results := []searchResult{}
+	err = filepath.Walk(start, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// skip what can't be read
+			return nil
+		}
+		// symlinks are not followed, they might point out of the root
+		if !fi.Mode().IsRegular() || !isObject(name) || fi.Size() > maxSize {
+			return nil
+		}
+		data, err := read(name, name)
+		if err != nil {
+			return nil
+		}
+
+		values := []interface{}{data}
+		if steps != nil {
+			values = eval(data, steps)
+		}
+		for _, v := range values {
+			if contains(v, q) {
+				p, _ := filepath.Rel(root, name)
+				p = filepath.ToSlash(p)
+				results = append(results, searchResult{Path: p, Link: strings.TrimSuffix(link(p), path.Ext(p))})
+				break
+			}
+		}
+		if len(results) >= maxSearchResults {
+			return errSearchLimit
+		}
+		return nil
+	})
+	if err != nil && err != errSearchLimit {
+		writeError(w, rel, err)
+		return
+	}
+	if err == errSearchLimit {
+		// more objects may match
+		w.Header().Set("X-Truncated", "true")
+	}
+	encode(w, format, results)
+}
+
+// selectPath returns the part of data selected by steps, a list if the path
+// may select several values, false if nothing is selected by a single value path
+func selectPath(steps []step, data interface{}) (interface{}, bool) {
+	values := eval(data, steps)
+	if multi(steps) {
+		if values == nil {
+			values = []interface{}{}
+		}
+		return values, true
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[0], true
+}
@@ -0,0 +1,204 @@
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testNode = `{
+  "metadata": {"name": "node-1", "labels": {"zone": "a", "pool": "default"}},
+  "status": {
+    "conditions": [
+      {"type": "Ready", "status": "True"},
+      {"type": "DiskPressure", "status": "False"},
+      {"type": "MemoryPressure", "status": "False"}
+    ],
+    "addresses": [{"type": "InternalIP", "address": "10.0.0.1"}]
+  }
+}`
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []step
+	}{
+		{".status.conditions", []step{{field: "status"}, {field: "conditions"}}},
+		{"status.conditions", []step{{field: "status"}, {field: "conditions"}}},
+		{"$.status.conditions[0]", []step{{field: "status"}, {field: "conditions"}, {index: 0}}},
+		{"{.status.conditions[-1].type}", []step{{field: "status"}, {field: "conditions"}, {index: -1}, {field: "type"}}},
+		{".metadata.labels[*]", []step{{field: "metadata"}, {field: "labels"}, {wildcard: true}}},
+		{".metadata.*", []step{{field: "metadata"}, {wildcard: true}}},
+		{`.metadata['a.b/c']`, []step{{field: "metadata"}, {field: "a.b/c"}}},
+		{`.metadata["x]y"]`, []step{{field: "metadata"}, {field: "x]y"}}},
+		{`.items[?(@.type=="Ready")]`, []step{{field: "items"}, {filter: &filter{field: []step{{field: "type"}}, op: "==", value: "Ready"}}}},
+		{`.items[?(@.a.b != 'x')]`, []step{{field: "items"}, {filter: &filter{field: []step{{field: "a"}, {field: "b"}}, op: "!=", value: "x"}}}},
+	}
+	for _, tt := range tests {
+		got, err := parsePath(tt.path)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %+v, %v, want %+v", tt.path, got, err, tt.want)
+		}
+	}
+
+	for _, p := range []string{
+		".items[0",
+		".items[x]",
+		".items['']",
+		`.items[""]`,
+		".items[]",
+		".items[?(type==Ready)]",
+		".items[?(@.type)]",
+	} {
+		if got, err := parsePath(p); err == nil {
+			t.Errorf("%q: got %+v, want an error", p, got)
+		}
+	}
+}
+
+func TestSelectPath(t *testing.T) {
+	var node interface{}
+	if err := json.Unmarshal([]byte(testNode), &node); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		want  string
+		found bool
+	}{
+		{".metadata.name", `"node-1"`, true},
+		{".status.conditions[0].type", `"Ready"`, true},
+		{".status.conditions[-1].type", `"MemoryPressure"`, true},
+		{".status.conditions[3]", "", false},
+		{".metadata.missing", "", false},
+		// the values of a map are sorted by key
+		{".metadata.labels[*]", `["default","a"]`, true},
+		{".status.conditions[*].type", `["Ready","DiskPressure","MemoryPressure"]`, true},
+		{`.status.conditions[?(@.type=="DiskPressure")].status`, `["False"]`, true},
+		{`.status.conditions[?(@.status!="False")].type`, `["Ready"]`, true},
+		// a path selecting several values is a list, even empty
+		{`.status.conditions[?(@.type=="PIDPressure")]`, `[]`, true},
+	}
+	for _, tt := range tests {
+		steps, err := parsePath(tt.path)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.path, err)
+		}
+		got, found := selectPath(steps, node)
+		if found != tt.found {
+			t.Errorf("%q: got found %v", tt.path, found)
+			continue
+		}
+		if !found {
+			continue
+		}
+		if out, _ := json.Marshal(got); string(out) != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.path, out, tt.want)
+		}
+	}
+}
+
+func TestGetObjPath(t *testing.T) {
+	root, done := testDump(t)
+	defer done()
+	if err := Init(root, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "node", "node-1.json"), []byte(testNode), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := getObj("node/node-1", "path=.status.conditions[0].status", "")
+	if w.Code != http.StatusOK || w.Body.String() != "\"True\"\n" {
+		t.Fatalf("got %d %q", w.Code, w.Body)
+	}
+	if w := getObj("node/node-1", "path=.status.missing", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing field: got %d", w.Code)
+	}
+	if w := getObj("node/node-1", "path=.items[", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid path: got %d", w.Code)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	root, done := testDump(t)
+	defer done()
+	if err := Init(root, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	for i, pressure := range []string{"True", "False", "False"} {
+		node := fmt.Sprintf(`{"metadata":{"name":"node-%d"},"status":{"conditions":[{"type":"Ready","status":"True"},{"type":"DiskPressure","status":"%s"}]}}`, i, pressure)
+		if err := ioutil.WriteFile(filepath.Join(root, "node", fmt.Sprintf("node-%d.json", i)), []byte(node), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(query string) (int, []searchResult, http.Header) {
+		r := httptest.NewRequest("GET", "/dump/search?"+query, nil)
+		w := httptest.NewRecorder()
+		Search(w, r)
+		var results []searchResult
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+		}
+		return w.Code, results, w.Header()
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		paths  []string
+	}{
+		{"q=node-1", http.StatusOK, []string{"node/node-1.json"}},
+		{"q=True", http.StatusOK, []string{"node/node-0.json", "node/node-1.json", "node/node-2.json"}},
+		{`q=True&path=.status.conditions[?(@.type=="DiskPressure")].status`, http.StatusOK, []string{"node/node-0.json"}},
+		{"q=Node&dir=node", http.StatusOK, []string{"node/a.json"}},
+		// the symlinks are not followed
+		{"q=true", http.StatusOK, []string{}},
+		{"q=nothing", http.StatusOK, []string{}},
+		{"q=True&dir=missing", http.StatusNotFound, nil},
+		{"q=True&dir=linked", http.StatusForbidden, nil},
+		{"path=.status", http.StatusBadRequest, nil},
+		{"q=True&path=.items[", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		status, results, header := search(tt.query)
+		if status != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.query, status, tt.status)
+			continue
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		paths := []string{}
+		for _, r := range results {
+			paths = append(paths, r.Path)
+		}
+		if !reflect.DeepEqual(paths, tt.paths) || header.Get("X-Truncated") != "" {
+			t.Errorf("%s: got %v, X-Truncated %q, want %v", tt.query, paths, header.Get("X-Truncated"), tt.paths)
+		}
+	}
+
+	// the results are truncated
+	many := filepath.Join(root, "many")
+	if err := os.Mkdir(many, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= maxSearchResults; i++ {
+		if err := ioutil.WriteFile(filepath.Join(many, fmt.Sprintf("%d.json", i)), []byte(`{"many":true}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status, results, header := search("q=true&dir=many")
+	if status != http.StatusOK || len(results) != maxSearchResults || header.Get("X-Truncated") != "true" {
+		t.Fatalf("truncated: got %d, %d results, X-Truncated %q", status, len(results), header.Get("X-Truncated"))
+	}
+}
@@ -0,0 +1,318 @@
+package dump
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// reserved are the names at the root of the dump tree taken by other
+// endpoints, an object uploaded there could never be read back
+var reserved = map[string]bool{"search": true, "diff": true, "archive": true}
+
+var (
+	// the quotas of the dump tree, checked on upload
+	maxTotalSize int64 = 1 << 30
+	maxFiles           = 10000
+	// uploadMu serializes the uploads, so two uploads can't both fit in the quotas
+	uploadMu sync.Mutex
+)
+
+// errQuota is returned when an upload would exceed the quotas of the dump tree
+var errQuota = errors.New("quota exceeded")
+
+// InitUpload sets the quotas of the dump tree: the total size of the files and
+// their number
+func InitUpload(maxTotal int64, files int) {
+	maxTotalSize = maxTotal
+	maxFiles = files
+}
+
+// usage returns the total size and the number of the files in the dump tree,
+// symlinks are not followed
+func usage() (int64, int, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	var files int
+	err = filepath.Walk(root, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files, err
+}
+
+// checkQuota makes sure the dump tree fits in the quotas once name is written
+// with size bytes
+func checkQuota(name string, size int64) error {
+	total, files, err := usage()
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(name); err == nil {
+		// replaced
+		total -= fi.Size()
+		files--
+	}
+	if total+size > maxTotalSize || files+1 > maxFiles {
+		return errQuota
+	}
+	return nil
+}
+
+// resolveNew returns the file rel would be written to, making sure the
+// closest existing parent directory is in the dump root and the file itself
+// is not a symlink
+func resolveNew(rel string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(root, filepath.Clean("/"+filepath.FromSlash(rel)))
+	if name == root {
+		return "", errIsDir
+	}
+
+	parent := filepath.Dir(name)
+	missing := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(parent)
+		if err == nil {
+			if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+				return "", errOutside
+			}
+			parent = filepath.Join(resolved, missing)
+			break
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		missing = filepath.Join(filepath.Base(parent), missing)
+		parent = filepath.Dir(parent)
+	}
+
+	name = filepath.Join(parent, filepath.Base(name))
+	if fi, err := os.Lstat(name); err == nil {
+		if fi.IsDir() {
+			return "", errIsDir
+		}
+		if !fi.Mode().IsRegular() {
+			return "", errOutside
+		}
+	}
+	return name, nil
+}
+
+// uploadExtension returns the extension of an uploaded object, from rel or the Content-Type
+func uploadExtension(r *http.Request, rel string) string {
+	if isObject(rel) {
+		return ""
+	}
+	t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch t {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return ".yaml"
+	}
+	return ".json"
+}
+
+// Upload stores a JSON or YAML object under the dump root, the extension is
+// taken from the Content-Type if path has none, an existing object is only
+// replaced with overwrite=true. The upload is refused when the dump tree would
+// exceed its quotas
+// example: kubectl get node foo -o yaml | curl --data-binary @- -H 'Content-Type: application/yaml' -X POST http://backend:8000/dump/node/foo
+func Upload(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(path.Clean("/"+mux.Vars(r)["path"]), "/")
+	if rel == "" || strings.TrimSuffix(path.Base(rel), path.Ext(rel)) == "" {
+		// e.g. POST /dump/ or /dump/node/.json
+		http.Error(w, "400 - the path of the object is required", http.StatusBadRequest)
+		return
+	}
+	if name := strings.TrimSuffix(rel, path.Ext(rel)); reserved[name] {
+		http.Error(w, "400 - "+name+" is reserved, use another path", http.StatusBadRequest)
+		return
+	}
+	rel += uploadExtension(r, rel)
+	overwrite, _ := strconv.ParseBool(r.URL.Query().Get("overwrite"))
+
+	raw, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("413 - the object must not be larger than %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if _, err := decode(rel, raw); err != nil {
+		http.Error(w, fmt.Sprintf("400 - invalid object: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	name, err := resolveNew(rel)
+	if err != nil {
+		writeError(w, rel, err)
+		return
+	}
+
+	uploadMu.Lock()
+	defer uploadMu.Unlock()
+	if err := checkQuota(name, int64(len(raw))); err != nil {
+		writeError(w, rel, err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		writeError(w, rel, err)
+		return
+	}
+	if overwrite {
+		err = replace(name, raw)
+	} else {
+		err = create(name, raw)
+	}
+	if os.IsExist(err) {
+		http.Error(w, "409 - "+rel+" already exists, use overwrite=true to replace it", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, rel, err)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(link(rel), path.Ext(rel)))
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "%s stored, %d bytes\n", rel, len(raw))
+}
+
+// create writes a new file, it fails if the file exists (e.g. created by
+// another pod sharing the volume since it was checked)
+func create(name string, raw []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(raw)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
+
+// replace writes a file through a temporary file, so readers never see half
+// an object
+func replace(name string, raw []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".upload-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(raw)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Archive streams the dump tree, or the subtree at path, as a tar.gz,
+// symlinks and files larger than the max size are left out
+// example: curl -o dump.tar.gz 'http://backend:8000/dump/archive?path=node'
+func Archive(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(path.Clean("/"+r.URL.Query().Get("path")), "/")
+	start, err := resolve(rel)
+	if err != nil {
+		writeError(w, rel, err)
+		return
+	}
+	fi, err := os.Stat(start)
+	if err != nil {
+		writeError(w, rel, err)
+		return
+	}
+	if !fi.IsDir() {
+		http.Error(w, "400 - "+rel+" is not a directory", http.StatusBadRequest)
+		return
+	}
+
+	base := "dump"
+	if rel != "" {
+		base = path.Base(rel)
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(base+".tar.gz"))
+	w.WriteHeader(http.StatusOK)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err = filepath.Walk(start, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			log.Printf("Archive : skipping %s: %s\n", name, err)
+			return nil
+		}
+		if !fi.IsDir() && (!fi.Mode().IsRegular() || fi.Size() > maxSize) {
+			return nil
+		}
+		p, err := filepath.Rel(start, name)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(base, filepath.ToSlash(p))
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.CopyN(tw, f, fi.Size())
+		return err
+	})
+	if err != nil {
+		// too late to change the status, abort the stream instead
+		log.Printf("Archive : ERROR : %s\n", err)
+		panic(http.ErrAbortHandler)
+	}
+	tw.Close()
+	gz.Close()
+}
@@ -0,0 +1,190 @@
+package dump
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// upload posts body to /dump/path with the given query and Content-Type
+func upload(path string, query string, contentType string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/dump/"+path+"?"+query, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	r = mux.SetURLVars(r, map[string]string{"path": path})
+	w := httptest.NewRecorder()
+	Upload(w, r)
+	return w
+}
+
+func TestUpload(t *testing.T) {
+	root, done := testDump(t)
+	defer done()
+	if err := Init(root, 64); err != nil {
+		t.Fatal(err)
+	}
+	defer InitUpload(maxTotalSize, maxFiles)
+	InitUpload(1<<20, 100)
+
+	tests := []struct {
+		name        string
+		path        string
+		query       string
+		contentType string
+		body        string
+		status      int
+		file        string
+	}{
+		{"json", "pod/a", "", "application/json", `{"kind":"Pod"}`, http.StatusCreated, "pod/a.json"},
+		{"yaml", "pod/b", "", "application/yaml", "kind: Pod\n", http.StatusCreated, "pod/b.yaml"},
+		{"extension", "pod/c.yml", "", "", "kind: Pod\n", http.StatusCreated, "pod/c.yml"},
+		{"no content type", "pod/d", "", "", `{"kind":"Pod"}`, http.StatusCreated, "pod/d.json"},
+		{"existing", "pod/a", "", "", `{"kind":"Node"}`, http.StatusConflict, ""},
+		{"overwrite", "pod/a", "overwrite=true", "", `{"kind":"Node"}`, http.StatusCreated, "pod/a.json"},
+		{"invalid", "pod/e", "", "", `{"kind":`, http.StatusBadRequest, ""},
+		{"too large", "pod/e", "", "", `{"kind":"` + strings.Repeat("x", 64) + `"}`, http.StatusRequestEntityTooLarge, ""},
+		{"no name", "pod/.json", "", "", `{}`, http.StatusBadRequest, ""},
+		{"root", "", "", "", `{}`, http.StatusBadRequest, ""},
+		{"directory", "node", "", "", `{}`, http.StatusCreated, "node.json"},
+		{"reserved search", "search", "", "", `{}`, http.StatusBadRequest, ""},
+		{"reserved diff", "diff.json", "", "", `{}`, http.StatusBadRequest, ""},
+		{"reserved archive", "archive", "", "application/yaml", "{}", http.StatusBadRequest, ""},
+		{"reserved below the root", "pod/search", "", "", `{}`, http.StatusCreated, "pod/search.json"},
+		{"dot dot", "../x", "", "", `{}`, http.StatusCreated, "x.json"},
+		{"symlinked file", "escape.json", "overwrite=true", "", `{}`, http.StatusForbidden, ""},
+		{"symlinked directory", "linked/x", "", "", `{}`, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		w := upload(tt.path, tt.query, tt.contentType, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d (%s)", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.file == "" {
+			continue
+		}
+		raw, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(tt.file)))
+		if err != nil || string(raw) != tt.body {
+			t.Errorf("%s: got %q, %v in %s", tt.name, raw, err, tt.file)
+		}
+		if got, want := w.Header().Get("Location"), "/dump/"+strings.TrimSuffix(tt.file, filepath.Ext(tt.file)); got != want {
+			t.Errorf("%s: got Location %q, want %q", tt.name, got, want)
+		}
+	}
+
+	// the file symlinked out of the root is left alone
+	if raw, _ := ioutil.ReadFile(filepath.Join(filepath.Dir(root), "outside", "secret.json")); string(raw) != `{"secret":true}` {
+		t.Fatalf("the upload wrote through a symlink: %q", raw)
+	}
+}
+
+func TestUploadQuota(t *testing.T) {
+	root, done := testDump(t)
+	defer done()
+	if err := Init(root, 1<<10); err != nil {
+		t.Fatal(err)
+	}
+	defer InitUpload(maxTotalSize, maxFiles)
+
+	size, files, err := usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// room for a single 10 bytes object
+	InitUpload(size+10, files+1)
+	if w := upload("a", "", "", `{"a":"12"}`); w.Code != http.StatusCreated {
+		t.Fatalf("first upload: got status %d (%s)", w.Code, w.Body)
+	}
+	if w := upload("b", "", "", `{}`); w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("too many files: got status %d", w.Code)
+	}
+	// a replaced object frees its size
+	if w := upload("a", "overwrite=true", "", `{"a":"34"}`); w.Code != http.StatusCreated {
+		t.Fatalf("overwrite: got status %d (%s)", w.Code, w.Body)
+	}
+	if w := upload("a", "overwrite=true", "", `{"a":"345"}`); w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("too large: got status %d", w.Code)
+	}
+	InitUpload(size+100, files+10)
+	if w := upload("b", "", "", `{"a":"345"}`); w.Code != http.StatusCreated {
+		t.Fatalf("raised quota: got status %d (%s)", w.Code, w.Body)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	root, done := testDump(t)
+	defer done()
+	if err := Init(root, 32); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := func(query string) (*httptest.ResponseRecorder, map[string]string) {
+		w := httptest.NewRecorder()
+		Archive(w, httptest.NewRequest("GET", "/dump/archive?"+query, nil))
+		if w.Code != http.StatusOK {
+			return w, nil
+		}
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{}
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, _ := ioutil.ReadAll(tr)
+			files[hdr.Name] = string(raw)
+		}
+		return w, files
+	}
+
+	// the symlinks and the files too large are left out
+	w, files := archive("")
+	want := map[string]string{
+		"dump/":                  "",
+		"dump/node/":             "",
+		"dump/node/a.json":       `{"kind":"Node"}`,
+		"dump/not-an-object.txt": "text",
+	}
+	if !reflect.DeepEqual(files, want) {
+		var names []string
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		t.Fatalf("got %v", names)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="dump.tar.gz"` {
+		t.Fatalf("got Content-Disposition %q", got)
+	}
+
+	if _, files := archive("path=nodes"); len(files) != 2 || files["nodes/a.json"] == "" {
+		t.Fatalf("symlinked subtree: got %v", files)
+	}
+	for query, status := range map[string]int{
+		"path=missing":     http.StatusNotFound,
+		"path=linked":      http.StatusForbidden,
+		"path=node/a.json": http.StatusBadRequest,
+	} {
+		if w, _ := archive(query); w.Code != status {
+			t.Errorf("%s: got status %d, want %d", query, w.Code, status)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package dump
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// viewTemplate renders an object as a collapsible tree, the tree is built
+// in the browser from the object and the links to the related dumps
+var viewTemplate = template.Must(template.New("view").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .Title}}/dump/{{.Title}}{{else}}dump{{end}}</title>
+<style>
+body { font-family: monospace; margin: 1em 2em; }
+details { margin-left: 1.2em; }
+summary { cursor: pointer; }
+.leaf { margin-left: 2.4em; }
+.key { color: #881391; }
+.string { color: #c41a16; }
+.number, .boolean { color: #1c00cf; }
+.null { color: #808080; }
+.count { color: #808080; }
+.hidden { display: none; }
+#toolbar { position: sticky; top: 0; background: #fff; padding: .5em 0; }
+</style>
+</head>
+<body>
+<p>{{range $i, $c := .Crumbs}}{{if $i}} / {{end}}<a href="{{$c.Link}}">{{$c.Name}}</a>{{end}}
+{{if .Title}} &middot; <a href="?format=json">json</a> <a href="?format=yaml">yaml</a>{{end}}</p>
+<div id="toolbar">
+<input id="filter" type="search" placeholder="filter keys and values" size="40" autofocus>
+<button id="expand">expand all</button> <button id="collapse">collapse all</button>
+</div>
+<div id="tree"></div>
+<script>
+var data = {{.Data}};
+var links = {{.Links}};
+
+// fieldPath builds the same paths as the server (e.g. .status.conditions[0].type)
+function fieldPath(p, k) {
+	return /[.\[\]']/.test(k) ? p + "['" + k + "']" : p + "." + k;
+}
+
+function leaf(key, value, path) {
+	var div = document.createElement("div");
+	div.className = "leaf";
+	div.dataset.text = (key + " " + value).toLowerCase();
+	if (key !== null) {
+		var k = document.createElement("span");
+		k.className = "key";
+		k.textContent = key + ": ";
+		div.appendChild(k);
+	}
+	var v = document.createElement(links[path] || (key === "link" && /^\/dump\//.test(value)) ? "a" : "span");
+	if (v.tagName === "A") {
+		v.href = links[path] || value;
+	}
+	v.className = value === null ? "null" : typeof value;
+	v.textContent = typeof value === "string" ? JSON.stringify(value) : String(value);
+	div.appendChild(v);
+	return div;
+}
+
+function tree(key, value, path, depth) {
+	if (value === null || typeof value !== "object") {
+		return leaf(key, value, path);
+	}
+	var list = Array.isArray(value);
+	var keys = list ? value.map(function (_, i) { return i; }) : Object.keys(value).sort();
+	var details = document.createElement("details");
+	details.open = depth < 3;
+	var summary = document.createElement("summary");
+	summary.innerHTML = (key !== null ? '<span class="key"></span>' : "") +
+		'<span class="count">' + (list ? "[" + keys.length + "]" : "{" + keys.length + "}") + "</span>";
+	if (key !== null) {
+		summary.firstChild.textContent = key + ": ";
+	}
+	details.appendChild(summary);
+	details.dataset.text = key === null ? "" : String(key).toLowerCase();
+	keys.forEach(function (k) {
+		var p = list ? path + "[" + k + "]" : fieldPath(path, k);
+		details.appendChild(tree(k, value[k], p, depth + 1));
+	});
+	return details;
+}
+
+// filter shows the leaves matching q and their parents, it returns whether el matches
+function filter(el, q) {
+	var match = q === "" || el.dataset.text.indexOf(q) >= 0;
+	if (el.tagName === "DETAILS") {
+		var any = false;
+		for (var i = 1; i < el.children.length; i++) {
+			// a matching object shows everything in it
+			any = filter(el.children[i], match ? "" : q) || any;
+		}
+		match = match || any;
+		if (q !== "" && match) {
+			el.open = true;
+		}
+	}
+	el.classList.toggle("hidden", !match);
+	return match;
+}
+
+var root = document.getElementById("tree");
+root.appendChild(tree(null, data, "", 0));
+document.getElementById("filter").addEventListener("input", function (e) {
+	filter(root.firstChild, e.target.value.trim().toLowerCase());
+});
+function openAll(open) {
+	root.querySelectorAll("details").forEach(function (d) { d.open = open; });
+}
+document.getElementById("expand").addEventListener("click", function () { openAll(true); });
+document.getElementById("collapse").addEventListener("click", function () { openAll(false); });
+</script>
+</body>
+</html>
+`))
+
+// crumbs returns the breadcrumbs of the dump path rel, a directory if dir is set
+func crumbs(rel string, dir bool) []crumb {
+	crumbs := []crumb{{Name: "dump", Link: "/dump/"}}
+	if rel == "" {
+		return crumbs
+	}
+	parts := strings.Split(rel, "/")
+	for i, p := range parts {
+		l := link(strings.Join(parts[:i+1], "/"))
+		if dir || i < len(parts)-1 {
+			l += "/"
+		}
+		crumbs = append(crumbs, crumb{Name: p, Link: l})
+	}
+	return crumbs
+}
+
+// view renders data (the object at rel, if any) as a collapsible tree
+func view(w http.ResponseWriter, rel string, data interface{}, links map[string]string) {
+	if links == nil {
+		links = map[string]string{}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := viewTemplate.Execute(w, map[string]interface{}{
+		"Title":  rel,
+		"Crumbs": crumbs(rel, false),
+		"Data":   data,
+		"Links":  links,
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// related returns the links from the fields of a kubernetes object to the
+// dumps of the objects they refer to, by path, e.g. the spec.nodeName of a
+// pod to its node, only the dumps which exist are linked
+func related(data interface{}) map[string]string {
+	links := map[string]string{}
+	root, _ := data.(map[string]interface{})
+	meta, _ := root["metadata"].(map[string]interface{})
+	namespace, _ := meta["namespace"].(string)
+
+	// add links p to the first of the dumps found
+	add := func(p string, candidates ...string) {
+		for _, c := range candidates {
+			if _, _, err := lookup(c); err == nil {
+				links[p] = link(c)
+				return
+			}
+		}
+	}
+
+	var walk func(p string, v interface{})
+	walk = func(p string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			// references with a kind and a name: ownerReferences, involvedObject, scaleTargetRef...
+			if k, ok := v["kind"].(string); ok && p != "" {
+				if name, ok := v["name"].(string); ok {
+					ns := namespace
+					if n, ok := v["namespace"].(string); ok {
+						ns = n
+					}
+					kind := strings.ToLower(k)
+					add(fieldPath(p, "name"), kind+"/"+ns+"_"+name, kind+"/_"+name)
+				}
+			}
+			for k, e := range v {
+				kp := fieldPath(p, k)
+				if s, ok := e.(string); ok && s != "" && !strings.ContainsAny(s, "/\\") {
+					switch k {
+					case "nodeName":
+						add(kp, "node/_"+s)
+					case "volumeName":
+						add(kp, "persistentvolume/_"+s)
+					case "claimName":
+						add(kp, "persistentvolumeclaim/"+namespace+"_"+s)
+					case "serviceAccountName":
+						add(kp, "serviceaccount/"+namespace+"_"+s)
+					case "namespace":
+						add(kp, "namespace/_"+s)
+					}
+					continue
+				}
+				walk(kp, e)
+			}
+		case []interface{}:
+			for i, e := range v {
+				walk(p+"["+strconv.Itoa(i)+"]", e)
+			}
+		}
+	}
+	walk("", data)
+	return links
+}
@@ -0,0 +1,412 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/credentials"
+)
+
+// maxChannelzSockets is the max number of sockets shown per server
+const maxChannelzSockets = 100
+
+// czSocket is a socket as shown on the channelz page
+type czSocket struct {
+	ID                  int64  `json:"id"`
+	Local               string `json:"local"`
+	Remote              string `json:"remote,omitempty"`
+	Security            string `json:"security,omitempty"`
+	StreamsStarted      int64  `json:"streamsStarted"`
+	StreamsSucceeded    int64  `json:"streamsSucceeded"`
+	StreamsFailed       int64  `json:"streamsFailed"`
+	MessagesSent        int64  `json:"messagesSent"`
+	MessagesReceived    int64  `json:"messagesReceived"`
+	KeepAlivesSent      int64  `json:"keepAlivesSent"`
+	LastMessageSent     string `json:"lastMessageSent,omitempty"`
+	LastMessageReceived string `json:"lastMessageReceived,omitempty"`
+}
+
+// czCalls are the call counters of a server or a channel
+type czCalls struct {
+	CallsStarted   int64  `json:"callsStarted"`
+	CallsSucceeded int64  `json:"callsSucceeded"`
+	CallsFailed    int64  `json:"callsFailed"`
+	LastCall       string `json:"lastCall,omitempty"`
+}
+
+// czServer is a server as shown on the channelz page
+type czServer struct {
+	ID int64 `json:"id"`
+	czCalls
+	ListenSockets []czSocket `json:"listenSockets"`
+	Sockets       []czSocket `json:"sockets"`
+	// More tells whether there are more sockets than shown
+	More bool `json:"more,omitempty"`
+}
+
+// czChannel is a channel (or a subchannel) as shown on the channelz page
+type czChannel struct {
+	ID     int64  `json:"id"`
+	Target string `json:"target"`
+	State  string `json:"state"`
+	czCalls
+	Events      []string    `json:"events,omitempty"`
+	Subchannels []czChannel `json:"subchannels,omitempty"`
+	Sockets     []czSocket  `json:"sockets,omitempty"`
+}
+
+var channelzTemplate = template.Must(template.New("channelz").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>channelz</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; margin: .5em 0 1.5em 0; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; font-size: small; }
+th { background: #eee; }
+.events { font-family: monospace; font-size: small; color: #555; }
+</style>
+</head>
+<body>
+<h1>channelz</h1>
+<p>{{.Time}} &middot; <a href="?format=json">json</a></p>
+
+{{define "calls"}}<td>{{.CallsStarted}}</td><td>{{.CallsSucceeded}}</td><td>{{.CallsFailed}}</td><td>{{.LastCall}}</td>{{end}}
+{{define "sockets"}}
+<table>
+<tr><th>socket</th><th>local</th><th>remote</th><th>security</th><th>streams started</th><th>succeeded</th><th>failed</th>
+<th>messages sent</th><th>received</th><th>keepalives sent</th><th>last message sent</th><th>last message received</th></tr>
+{{range .}}<tr><td>{{.ID}}</td><td>{{.Local}}</td><td>{{.Remote}}</td><td>{{.Security}}</td>
+<td>{{.StreamsStarted}}</td><td>{{.StreamsSucceeded}}</td><td>{{.StreamsFailed}}</td>
+<td>{{.MessagesSent}}</td><td>{{.MessagesReceived}}</td><td>{{.KeepAlivesSent}}</td>
+<td>{{.LastMessageSent}}</td><td>{{.LastMessageReceived}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Servers</h2>
+{{range .Servers}}
+<h3>server {{.ID}}</h3>
+<table>
+<tr><th>calls started</th><th>succeeded</th><th>failed</th><th>last call</th></tr>
+<tr>{{template "calls" .}}</tr>
+</table>
+<h4>listening</h4>
+{{template "sockets" .ListenSockets}}
+<h4>connections{{if .More}} (first {{len .Sockets}}){{end}}</h4>
+{{template "sockets" .Sockets}}
+{{end}}
+
+<h2>Channels</h2>
+{{range .Channels}}
+<h3>channel {{.ID}}: {{.Target}}</h3>
+<table>
+<tr><th>state</th><th>calls started</th><th>succeeded</th><th>failed</th><th>last call</th></tr>
+<tr><td>{{.State}}</td>{{template "calls" .}}</tr>
+</table>
+{{if .Events}}<div class="events">{{range .Events}}{{.}}<br>{{end}}</div>{{end}}
+{{range .Subchannels}}
+<h4>subchannel {{.ID}}: {{.Target}}</h4>
+<table>
+<tr><th>state</th><th>calls started</th><th>succeeded</th><th>failed</th><th>last call</th></tr>
+<tr><td>{{.State}}</td>{{template "calls" .}}</tr>
+</table>
+{{if .Events}}<div class="events">{{range .Events}}{{.}}<br>{{end}}</div>{{end}}
+{{template "sockets" .Sockets}}
+{{end}}
+{{else}}
+<p>no channels</p>
+{{end}}
+</body>
+</html>
+`))
+
+// ChannelzPage shows the channelz data of the process, as read from the
+// channelz service of the gRPC server at addr
+type ChannelzPage struct {
+	addr  string
+	creds credentials.TransportCredentials
+
+	mu     sync.Mutex
+	client channelzpb.ChannelzClient
+}
+
+// NewChannelzPage returns a ChannelzPage reading from the gRPC server at
+// addr, over TLS if certFile (the certificate of the server) is set
+func NewChannelzPage(addr string, certFile string) (*ChannelzPage, error) {
+	p := &ChannelzPage{addr: addr}
+	if certFile != "" {
+		pinned, err := loadCertificate(certFile)
+		if err != nil {
+			return nil, err
+		}
+		// the server is this process, dialed as localhost which its
+		// certificate may not name: the certificate is pinned instead of
+		// being verified against a CA
+		p.creds = credentials.NewTLS(&tls.Config{
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], pinned) {
+					return errors.New("the server certificate is not the one of this process")
+				}
+				return nil
+			},
+		})
+	}
+	return p, nil
+}
+
+// loadCertificate returns the first certificate of a PEM file, in DER
+func loadCertificate(name string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate found in %s", name)
+		}
+		if block.Type == "CERTIFICATE" {
+			return block.Bytes, nil
+		}
+	}
+}
+
+// connect dials the server on first use, a failed dial is tried again on
+// the next request
+func (p *ChannelzPage) connect() (channelzpb.ChannelzClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	opt := grpc.WithInsecure()
+	if p.creds != nil {
+		opt = grpc.WithTransportCredentials(p.creds)
+	}
+	// the connection shows up as one of the channels
+	conn, err := grpc.Dial(p.addr, opt)
+	if err != nil {
+		return nil, err
+	}
+	p.client = channelzpb.NewChannelzClient(conn)
+	return p.client, nil
+}
+
+// ServeHTTP renders the servers, their sockets and the channels, as JSON with format=json
+func (p *ChannelzPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client, err := p.connect()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	servers, err := channelzServers(ctx, client)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	channels, err := channelzChannels(ctx, client)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	data := map[string]interface{}{
+		"time":     time.Now().Format(time.RFC3339),
+		"servers":  servers,
+		"channels": channels,
+	}
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(data)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = channelzTemplate.Execute(w, map[string]interface{}{
+		"Time":     data["time"],
+		"Servers":  servers,
+		"Channels": channels,
+	})
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func channelzServers(ctx context.Context, client channelzpb.ChannelzClient) ([]czServer, error) {
+	var servers []czServer
+	var start int64
+	for {
+		resp, err := client.GetServers(ctx, &channelzpb.GetServersRequest{StartServerId: start})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Server {
+			id := s.Ref.GetServerId()
+			start = id + 1
+			server := czServer{ID: id, czCalls: serverCalls(s.Data), ListenSockets: []czSocket{}, Sockets: []czSocket{}}
+
+			for _, ref := range s.ListenSocket {
+				sock, err := channelzSocket(ctx, client, ref.SocketId)
+				if err != nil {
+					return nil, err
+				}
+				server.ListenSockets = append(server.ListenSockets, sock)
+			}
+
+			socks, err := client.GetServerSockets(ctx, &channelzpb.GetServerSocketsRequest{ServerId: id, MaxResults: maxChannelzSockets})
+			if err != nil {
+				return nil, err
+			}
+			server.More = !socks.End
+			for _, ref := range socks.SocketRef {
+				sock, err := channelzSocket(ctx, client, ref.SocketId)
+				if err != nil {
+					// the connection may have been closed since
+					continue
+				}
+				server.Sockets = append(server.Sockets, sock)
+			}
+			servers = append(servers, server)
+		}
+		if resp.End || len(resp.Server) == 0 {
+			return servers, nil
+		}
+	}
+}
+
+func channelzChannels(ctx context.Context, client channelzpb.ChannelzClient) ([]czChannel, error) {
+	channels := []czChannel{}
+	var start int64
+	for {
+		resp, err := client.GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{StartChannelId: start})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range resp.Channel {
+			start = c.Ref.GetChannelId() + 1
+			channel := channelData(c.Ref.GetChannelId(), c.Data)
+			for _, ref := range c.SubchannelRef {
+				sc, err := client.GetSubchannel(ctx, &channelzpb.GetSubchannelRequest{SubchannelId: ref.SubchannelId})
+				if err != nil {
+					continue
+				}
+				sub := channelData(ref.SubchannelId, sc.Subchannel.GetData())
+				for _, sref := range sc.Subchannel.GetSocketRef() {
+					if sock, err := channelzSocket(ctx, client, sref.SocketId); err == nil {
+						sub.Sockets = append(sub.Sockets, sock)
+					}
+				}
+				channel.Subchannels = append(channel.Subchannels, sub)
+			}
+			channels = append(channels, channel)
+		}
+		if resp.End || len(resp.Channel) == 0 {
+			return channels, nil
+		}
+	}
+}
+
+func channelzSocket(ctx context.Context, client channelzpb.ChannelzClient, id int64) (czSocket, error) {
+	resp, err := client.GetSocket(ctx, &channelzpb.GetSocketRequest{SocketId: id})
+	if err != nil {
+		return czSocket{}, err
+	}
+	s := resp.Socket
+	d := s.GetData()
+	sock := czSocket{
+		ID:                  id,
+		Local:               address(s.Local),
+		Remote:              address(s.Remote),
+		StreamsStarted:      d.GetStreamsStarted(),
+		StreamsSucceeded:    d.GetStreamsSucceeded(),
+		StreamsFailed:       d.GetStreamsFailed(),
+		MessagesSent:        d.GetMessagesSent(),
+		MessagesReceived:    d.GetMessagesReceived(),
+		KeepAlivesSent:      d.GetKeepAlivesSent(),
+		LastMessageSent:     timestamp(d.GetLastMessageSentTimestamp().GetSeconds(), d.GetLastMessageSentTimestamp().GetNanos()),
+		LastMessageReceived: timestamp(d.GetLastMessageReceivedTimestamp().GetSeconds(), d.GetLastMessageReceivedTimestamp().GetNanos()),
+	}
+	if tls := s.GetSecurity().GetTls(); tls != nil {
+		sock.Security = "TLS " + tls.GetStandardName() + tls.GetOtherName()
+	} else if other := s.GetSecurity().GetOther(); other != nil {
+		sock.Security = other.Name
+	}
+	return sock, nil
+}
+
+func serverCalls(d *channelzpb.ServerData) czCalls {
+	return czCalls{
+		CallsStarted:   d.GetCallsStarted(),
+		CallsSucceeded: d.GetCallsSucceeded(),
+		CallsFailed:    d.GetCallsFailed(),
+		LastCall:       timestamp(d.GetLastCallStartedTimestamp().GetSeconds(), d.GetLastCallStartedTimestamp().GetNanos()),
+	}
+}
+
+func channelData(id int64, d *channelzpb.ChannelData) czChannel {
+	c := czChannel{
+		ID:     id,
+		Target: d.GetTarget(),
+		State:  d.GetState().GetState().String(),
+		czCalls: czCalls{
+			CallsStarted:   d.GetCallsStarted(),
+			CallsSucceeded: d.GetCallsSucceeded(),
+			CallsFailed:    d.GetCallsFailed(),
+			LastCall:       timestamp(d.GetLastCallStartedTimestamp().GetSeconds(), d.GetLastCallStartedTimestamp().GetNanos()),
+		},
+	}
+	for _, e := range d.GetTrace().GetEvents() {
+		c.Events = append(c.Events, fmt.Sprintf("%s %s %s",
+			timestamp(e.GetTimestamp().GetSeconds(), e.GetTimestamp().GetNanos()), e.Severity, e.Description))
+	}
+	return c
+}
+
+// address formats a channelz address, e.g. 10.0.0.1:50000
+func address(a *channelzpb.Address) string {
+	switch {
+	case a.GetTcpipAddress() != nil:
+		ip := a.GetTcpipAddress()
+		return net.JoinHostPort(net.IP(ip.IpAddress).String(), strconv.Itoa(int(ip.Port)))
+	case a.GetUdsAddress() != nil:
+		return "unix:" + a.GetUdsAddress().Filename
+	case a.GetOtherAddress() != nil:
+		return a.GetOtherAddress().Name
+	}
+	return ""
+}
+
+// timestamp formats the time of a channelz timestamp, empty if not set
+// (grpc sends the zero time.Time when nothing happened yet)
+func timestamp(sec int64, nsec int32) string {
+	t := time.Unix(sec, int64(nsec)).UTC()
+	if (sec == 0 && nsec == 0) || t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
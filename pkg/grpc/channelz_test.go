@@ -0,0 +1,176 @@
+package grpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/credentials"
+)
+
+// writeCert writes a self-signed certificate for name and its key to dir
+func writeCert(t *testing.T, dir string, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// serveChannelz serves channelz on a local port, over TLS with the
+// certificate and key if set, it returns the address and a func to stop
+func serveChannelz(t *testing.T, certFile string, keyFile string) (string, func()) {
+	var opts []grpc.ServerOption
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(opts...)
+	channelz.RegisterChannelzServiceToServer(s)
+	go s.Serve(lis)
+	return lis.Addr().String(), s.Stop
+}
+
+// listens tells whether one of the servers of the page listens on addr
+func listens(t *testing.T, p *ChannelzPage, addr string) bool {
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/channelz?format=json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("json: got status %d (%s)", w.Code, w.Body)
+	}
+	var data struct {
+		Servers []czServer `json:"servers"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range data.Servers {
+		for _, l := range s.ListenSockets {
+			if l.Local == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestChannelzPage(t *testing.T) {
+	addr, stop := serveChannelz(t, "", "")
+	defer stop()
+
+	p, err := NewChannelzPage(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !listens(t, p, addr) {
+		t.Errorf("json: no server listening on %s", addr)
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/channelz", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("html: got status %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	// the page connection is one of the channels
+	if !strings.Contains(w.Body.String(), addr) {
+		t.Errorf("html: %s not shown", addr)
+	}
+}
+
+func TestChannelzPageTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "channelz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the certificates do not name the address dialed
+	certFile, keyFile := writeCert(t, dir, "tiddles.example.com")
+	otherFile, _ := writeCert(t, dir, "other.example.com")
+
+	addr, stop := serveChannelz(t, certFile, keyFile)
+	defer stop()
+
+	p, err := NewChannelzPage(addr, certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !listens(t, p, addr) {
+		t.Errorf("json: no server listening on %s", addr)
+	}
+
+	// a server with another certificate is not trusted
+	p, err = NewChannelzPage(addr, otherFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/channelz?format=json", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("another certificate: got status %d, want %d", w.Code, http.StatusBadGateway)
+	}
+
+	for _, name := range []string{filepath.Join(dir, "missing.crt"), writeKey(t, dir)} {
+		if _, err := NewChannelzPage(addr, name); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+// writeKey writes a PEM file holding no certificate to dir
+func writeKey(t *testing.T, dir string) string {
+	name := filepath.Join(dir, "nocert.pem")
+	if err := ioutil.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte{0}}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
@@ -36,12 +36,9 @@ import (
 
 	"go.opencensus.io/plugin/ocgrpc"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	pb "google.golang.org/grpc/examples/helloworld/helloworld"
-	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 // GreeterServer is the server API for Greeter service
@@ -62,20 +59,6 @@ func (s *GreeterServer) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.
 	return &pb.HelloReply{Message: "Hello " + in.Name}, nil
 }
 
-// HealthServer is the health check API
-type HealthServer struct{}
-
-// Check is used for health checks
-func (s *HealthServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
-	log.Printf("Handling Check request [%v]", in)
-	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
-}
-
-// Watch is not implemented
-func (s *HealthServer) Watch(in *healthpb.HealthCheckRequest, srv healthpb.Health_WatchServer) error {
-	return status.Error(codes.Unimplemented, "Watch is not implemented")
-}
-
 // PingBackend probes the specificed grpc server
 func PingBackend(ctx context.Context, addr string, cert string) *[]string {
 	// Set up a connection to the server.
@@ -0,0 +1,148 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// HealthServer is the health check API, the status of every service can be
+// changed at runtime (see ServeHTTP), the empty service is the server itself
+type HealthServer struct {
+	mu       sync.Mutex
+	statuses map[string]healthpb.HealthCheckResponse_ServingStatus
+	// watchers of each service, a channel only holds the latest status
+	watchers map[string]map[chan healthpb.HealthCheckResponse_ServingStatus]bool
+}
+
+// NewHealthServer returns a HealthServer where the server itself is SERVING
+func NewHealthServer() *HealthServer {
+	return &HealthServer{
+		statuses: map[string]healthpb.HealthCheckResponse_ServingStatus{"": healthpb.HealthCheckResponse_SERVING},
+		watchers: map[string]map[chan healthpb.HealthCheckResponse_ServingStatus]bool{},
+	}
+}
+
+// SetServingStatus sets the status of service and notifies its watchers
+func (s *HealthServer) SetServingStatus(service string, st healthpb.HealthCheckResponse_ServingStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.statuses[service]; ok && old == st {
+		return
+	}
+	log.Printf("Health : %q is now %s\n", service, st)
+	s.statuses[service] = st
+	for ch := range s.watchers[service] {
+		// drop the status not read yet, the watcher only needs the latest
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- st
+	}
+}
+
+// Statuses returns the status of every service
+func (s *HealthServer) Statuses() map[string]healthpb.HealthCheckResponse_ServingStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]healthpb.HealthCheckResponse_ServingStatus, len(s.statuses))
+	for k, v := range s.statuses {
+		out[k] = v
+	}
+	return out
+}
+
+// Check is used for health checks, an unknown service reports the status of
+// the server itself
+func (s *HealthServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	log.Printf("Handling Check request [%v]", in)
+	s.mu.Lock()
+	st, ok := s.statuses[in.Service]
+	if !ok {
+		st = s.statuses[""]
+	}
+	s.mu.Unlock()
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch streams the status of a service, the current status first then
+// every change, an unknown service is SERVICE_UNKNOWN until it is set
+func (s *HealthServer) Watch(in *healthpb.HealthCheckRequest, srv healthpb.Health_WatchServer) error {
+	log.Printf("Handling Watch request [%v]", in)
+	ch := make(chan healthpb.HealthCheckResponse_ServingStatus, 1)
+
+	s.mu.Lock()
+	if st, ok := s.statuses[in.Service]; ok {
+		ch <- st
+	} else {
+		ch <- healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	if s.watchers[in.Service] == nil {
+		s.watchers[in.Service] = map[chan healthpb.HealthCheckResponse_ServingStatus]bool{}
+	}
+	s.watchers[in.Service][ch] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.watchers[in.Service], ch)
+		if len(s.watchers[in.Service]) == 0 {
+			delete(s.watchers, in.Service)
+		}
+		s.mu.Unlock()
+	}()
+
+	var last healthpb.HealthCheckResponse_ServingStatus = -1
+	for {
+		select {
+		case st := <-ch:
+			if st == last {
+				continue
+			}
+			if err := srv.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return status.Error(codes.Canceled, "stream has ended")
+			}
+			last = st
+		case <-srv.Context().Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		}
+	}
+}
+
+// ServeHTTP lists the status of the services on GET, and sets the status
+// of a service on PUT (service defaults to the server itself)
+// example: curl -X PUT 'http://backend:8000/grpc/health?service=helloworld.Greeter&status=NOT_SERVING'
+func (s *HealthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		params := r.URL.Query()
+		v, ok := healthpb.HealthCheckResponse_ServingStatus_value[strings.ToUpper(params.Get("status"))]
+		if !ok {
+			names := make([]string, 0, len(healthpb.HealthCheckResponse_ServingStatus_name))
+			for _, n := range healthpb.HealthCheckResponse_ServingStatus_name {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			http.Error(w, fmt.Sprintf("400 - invalid status %q, use one of %s", params.Get("status"), strings.Join(names, ", ")), http.StatusBadRequest)
+			return
+		}
+		s.SetServingStatus(params.Get("service"), healthpb.HealthCheckResponse_ServingStatus(v))
+	}
+
+	out := map[string]string{}
+	for k, v := range s.Statuses() {
+		out[k] = v.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(out)
+}
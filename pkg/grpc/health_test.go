@@ -0,0 +1,147 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// serveHealth serves h on a local port, it returns a client and a func to stop
+func serveHealth(t *testing.T, h *HealthServer) (healthpb.HealthClient, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, h)
+	go s.Serve(lis)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		s.Stop()
+		t.Fatal(err)
+	}
+	return healthpb.NewHealthClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	h := NewHealthServer()
+	client, stop := serveHealth(t, h)
+	defer stop()
+	h.SetServingStatus("helloworld.Greeter", healthpb.HealthCheckResponse_SERVING)
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("%q: %v", service, err)
+		}
+		return resp.Status
+	}
+	if got := check(""); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("server: got %s", got)
+	}
+	h.SetServingStatus("helloworld.Greeter", healthpb.HealthCheckResponse_NOT_SERVING)
+	if got := check("helloworld.Greeter"); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("greeter: got %s", got)
+	}
+	// an unknown service is the server itself
+	if got := check("unknown"); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("unknown: got %s", got)
+	}
+	h.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if got := check("unknown"); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("unknown, server not serving: got %s", got)
+	}
+}
+
+func TestHealthWatch(t *testing.T) {
+	h := NewHealthServer()
+	client, stop := serveHealth(t, h)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	watch := func(service string) healthpb.Health_WatchClient {
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stream
+	}
+	expect := func(stream healthpb.Health_WatchClient, want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		resp, err := stream.Recv()
+		if err != nil || resp.Status != want {
+			t.Fatalf("got %v, %v, want %s", resp, err, want)
+		}
+	}
+
+	server := watch("")
+	expect(server, healthpb.HealthCheckResponse_SERVING)
+	greeter := watch("helloworld.Greeter")
+	expect(greeter, healthpb.HealthCheckResponse_SERVICE_UNKNOWN)
+
+	// the watchers are registered before the first status is sent
+	h.SetServingStatus("helloworld.Greeter", healthpb.HealthCheckResponse_SERVING)
+	expect(greeter, healthpb.HealthCheckResponse_SERVING)
+	h.SetServingStatus("helloworld.Greeter", healthpb.HealthCheckResponse_NOT_SERVING)
+	expect(greeter, healthpb.HealthCheckResponse_NOT_SERVING)
+	h.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	expect(server, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	// the watchers are dropped with their stream
+	cancel()
+	for i := 0; ; i++ {
+		h.mu.Lock()
+		n := len(h.watchers)
+		h.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if i > 1000 {
+			t.Fatalf("got %d services still watched", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHealthHTTP(t *testing.T) {
+	h := NewHealthServer()
+	serve := func(method string, url string) (int, map[string]string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		var out map[string]string
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, out
+	}
+
+	if code, out := serve("GET", "/grpc/health"); code != http.StatusOK || len(out) != 1 || out[""] != "SERVING" {
+		t.Fatalf("get: got %d %v", code, out)
+	}
+	if code, out := serve("PUT", "/grpc/health?service=helloworld.Greeter&status=not_serving"); code != http.StatusOK || out["helloworld.Greeter"] != "NOT_SERVING" {
+		t.Fatalf("put: got %d %v", code, out)
+	}
+	if code, out := serve("PUT", "/grpc/health?status=NOT_SERVING"); code != http.StatusOK || out[""] != "NOT_SERVING" {
+		t.Fatalf("put server: got %d %v", code, out)
+	}
+	if code, _ := serve("PUT", "/grpc/health?service=x&status=DOWN"); code != http.StatusBadRequest {
+		t.Fatalf("put invalid status: got %d", code)
+	}
+	if _, ok := h.Statuses()["x"]; ok {
+		t.Fatalf("an invalid status was set")
+	}
+}
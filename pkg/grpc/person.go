@@ -0,0 +1,213 @@
+//go:generate protoc -I person --go_out=plugins=grpc,paths=source_relative:person person/person.proto
+
+package grpc
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/neoseele/tiddles/pkg/db"
+	personpb "github.com/neoseele/tiddles/pkg/grpc/person"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// PersonServer is the gRPC counterpart of the /db REST API, both share the same store
+type PersonServer struct {
+	Store db.Store
+}
+
+// storeError maps the errors returned by a db.Store to a gRPC status
+func storeError(err error) error {
+	switch err {
+	case db.ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case db.ErrExists:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case db.ErrConflict:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// writer returns the store to make the changes asked for by the call through,
+// the changes are recorded with the x-request-id metadata (if any)
+func (s *PersonServer) writer(ctx context.Context) db.Store {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("x-request-id"); len(v) > 0 {
+			id = v[0]
+		}
+	}
+	return db.WithOrigin(s.Store, id)
+}
+
+func toPB(p db.Person) *personpb.Person {
+	out := &personpb.Person{
+		Id:        p.ID,
+		Firstname: p.Firstname,
+		Lastname:  p.Lastname,
+		Version:   p.Version,
+	}
+	if p.Address != nil {
+		out.Address = &personpb.Address{City: p.Address.City, State: p.Address.State}
+	}
+	return out
+}
+
+func fromPB(in *personpb.Person) (db.Person, error) {
+	if in == nil {
+		return db.Person{}, status.Error(codes.InvalidArgument, "person is required")
+	}
+	p := db.Person{
+		ID:        in.Id,
+		Firstname: in.Firstname,
+		Lastname:  in.Lastname,
+	}
+	if in.Address != nil {
+		p.Address = &db.Address{City: in.Address.City, State: in.Address.State}
+	}
+	if err := p.Validate(); err != nil {
+		return p, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return p, nil
+}
+
+// toQuery converts the request into the same query the REST API would build
+func toQuery(in *personpb.ListPeopleRequest) (db.Query, error) {
+	v := url.Values{}
+	for name, value := range map[string]string{
+		"firstname": in.Firstname,
+		"lastname":  in.Lastname,
+		"city":      in.City,
+		"state":     in.State,
+		"sort":      in.Sort,
+	} {
+		if value != "" {
+			v.Set(name, value)
+		}
+	}
+	if in.Limit != 0 {
+		v.Set("limit", strconv.Itoa(int(in.Limit)))
+	}
+	if in.Offset != 0 {
+		v.Set("offset", strconv.Itoa(int(in.Offset)))
+	}
+
+	q, err := db.ParseQuery(v)
+	if err != nil {
+		return q, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return q, nil
+}
+
+// Get implements person.PersonServiceServer
+func (s *PersonServer) Get(ctx context.Context, in *personpb.GetPersonRequest) (*personpb.Person, error) {
+	p, err := s.Store.Get(in.Id)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return toPB(p), nil
+}
+
+// List implements person.PersonServiceServer
+func (s *PersonServer) List(ctx context.Context, in *personpb.ListPeopleRequest) (*personpb.ListPeopleResponse, error) {
+	q, err := toQuery(in)
+	if err != nil {
+		return nil, err
+	}
+
+	people, total, err := s.Store.List(q)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	out := &personpb.ListPeopleResponse{Total: int32(total)}
+	for _, p := range people {
+		out.People = append(out.People, toPB(p))
+	}
+	return out, nil
+}
+
+// StreamList implements person.PersonServiceServer, the people are read
+// from the store page by page
+func (s *PersonServer) StreamList(in *personpb.ListPeopleRequest, srv personpb.PersonService_StreamListServer) error {
+	q, err := toQuery(in)
+	if err != nil {
+		return err
+	}
+
+	const pageSize = 100
+	remaining := q.Limit
+	for {
+		page := q
+		page.Limit = pageSize
+		if remaining > 0 && remaining < pageSize {
+			page.Limit = remaining
+		}
+
+		people, _, err := s.Store.List(page)
+		if err != nil {
+			return storeError(err)
+		}
+		for _, p := range people {
+			if err := srv.Send(toPB(p)); err != nil {
+				return err
+			}
+		}
+
+		q.Offset += len(people)
+		if remaining > 0 {
+			remaining -= len(people)
+			if remaining == 0 {
+				return nil
+			}
+		}
+		if len(people) < page.Limit {
+			return nil
+		}
+		if err := srv.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+}
+
+// Create implements person.PersonServiceServer
+func (s *PersonServer) Create(ctx context.Context, in *personpb.CreatePersonRequest) (*personpb.Person, error) {
+	p, err := fromPB(in.Person)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.writer(ctx).Create(p); err != nil {
+		return nil, storeError(err)
+	}
+	p.Version = 1
+	return toPB(p), nil
+}
+
+// Update implements person.PersonServiceServer
+func (s *PersonServer) Update(ctx context.Context, in *personpb.UpdatePersonRequest) (*personpb.Person, error) {
+	p, err := fromPB(in.Person)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err = s.writer(ctx).Update(p, in.Version)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return toPB(p), nil
+}
+
+// Delete implements person.PersonServiceServer
+func (s *PersonServer) Delete(ctx context.Context, in *personpb.DeletePersonRequest) (*personpb.DeletePersonResponse, error) {
+	if err := s.writer(ctx).Delete(in.Id, in.Version); err != nil {
+		return nil, storeError(err)
+	}
+	return &personpb.DeletePersonResponse{}, nil
+}
@@ -0,0 +1,837 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: person.proto
+
+package person
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Address struct {
+	City                 string   `protobuf:"bytes,1,opt,name=city,proto3" json:"city,omitempty"`
+	State                string   `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Address) Reset()         { *m = Address{} }
+func (m *Address) String() string { return proto.CompactTextString(m) }
+func (*Address) ProtoMessage()    {}
+func (*Address) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4c9e10cf24b1156d, []int{0}
+}
+
+func (m *Address) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Address.Unmarshal(m, b)
+}
+func (m *Address) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Address.Marshal(b, m, deterministic)
+}
+func (m *Address) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Address.Merge(m, src)
+}
+func (m *Address) XXX_Size() int {
+	return xxx_messageInfo_Address.Size(m)
+}
+func (m *Address) XXX_DiscardUnknown() {
+	xxx_messageInfo_Address.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Address proto.InternalMessageInfo
+
+func (m *Address) GetCity() string {
+	if m != nil {
+		return m.City
+	}
+	return ""
+}
+
+func (m *Address) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+type Person struct {
+	Id        string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Firstname string   `protobuf:"bytes,2,opt,name=firstname,proto3" json:"firstname,omitempty"`
+	Lastname  string   `protobuf:"bytes,3,opt,name=lastname,proto3" json:"lastname,omitempty"`
+	Address   *Address `protobuf:"bytes,4,opt,name=address,proto3" json:"address,omitempty"`
+	// Bumped by the store on every update.
+	Version              int64    `protobuf:"varint,5,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Person) Reset()         { *m = Person{} }
+func (m *Person) String() string { return proto.CompactTextString(m) }
+func (*Person) ProtoMessage()    {}
+func (*Person) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4c9e10cf24b1156d, []int{1}
+}
+
+func (m *Person) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Person.Unmarshal(m, b)
+}
+func (m *Person) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Person.Marshal(b, m, deterministic)
+}
+func (m *Person) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Person.Merge(m, src)
+}
+func (m *Person) XXX_Size() int {
+	return xxx_messageInfo_Person.Size(m)
+}
+func (m *Person) XXX_DiscardUnknown() {
+	xxx_messageInfo_Person.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Person proto.InternalMessageInfo
+
+func (m *Person) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Person) GetFirstname() string {
+	if m != nil {
+		return m.Firstname
+	}
+	return ""
+}
+
+func (m *Person) GetLastname() string {
+	if m != nil {
+		return m.Lastname
+	}
+	return ""
+}
+
+func (m *Person) GetAddress() *Address {
+	if m != nil {
+		return m.Address
+	}
+	return nil
+}
+
+func (m *Person) GetVersion() int64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+type GetPersonRequest struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetPersonRequest) Reset()         { *m = GetPersonRequest{} }
+func (m *GetPersonRequest) String() string { return proto.CompactTextString(m) }
+func (*GetPersonRequest) ProtoMessage()    {}
+func (*GetPersonRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4c9e10cf24b1156d, []int{2}
+}
+
+func (m *GetPersonRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetPersonRequest.Unmarshal(m, b)
+}
+func (m *GetPersonRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetPersonRequest.Marshal(b, m, deterministic)
+}
+func (m *GetPersonRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetPersonRequest.Merge(m, src)
+}
+func (m *GetPersonRequest) XXX_Size() int {
+	return xxx_messageInfo_GetPersonRequest.Size(m)
+}
+func (m *GetPersonRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetPersonRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetPersonRequest proto.InternalMessageInfo
+
+func (m *GetPersonRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type ListPeopleRequest struct {
+	// Filters, an empty value matches everything.
+	Firstname string `protobuf:"bytes,1,opt,name=firstname,proto3" json:"firstname,omitempty"`
+	Lastname  string `protobuf:"bytes,2,opt,name=lastname,proto3" json:"lastname,omitempty"`
+	City      string `protobuf:"bytes,3,opt,name=city,proto3" json:"city,omitempty"`
+	State     string `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	// One of id, firstname, lastname, city or state, prefixed with - to sort
+	// descending.
+	Sort                 string   `protobuf:"bytes,5,opt,name=sort,proto3" json:"sort,omitempty"`
+	Limit                int32    `protobuf:"varint,6,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset               int32    `protobuf:"varint,7,opt,name=offset,proto3" json:"offset,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListPeopleRequest) Reset()         { *m = ListPeopleRequest{} }
+func (m *ListPeopleRequest) String() string { return proto.CompactTextString(m) }
+func (*ListPeopleRequest) ProtoMessage()    {}
+func (*ListPeopleRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4c9e10cf24b1156d, []int{3}
+}
+
+func (m *ListPeopleRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListPeopleRequest.Unmarshal(m, b)
+}
+func (m *ListPeopleRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListPeopleRequest.Marshal(b, m, deterministic)
+}
+func (m *ListPeopleRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListPeopleRequest.Merge(m, src)
+}
+func (m *ListPeopleRequest) XXX_Size() int {
+	return xxx_messageInfo_ListPeopleRequest.Size(m)
+}
+func (m *ListPeopleRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListPeopleRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListPeopleRequest proto.InternalMessageInfo
+
+func (m *ListPeopleRequest) GetFirstname() string {
+	if m != nil {
+		return m.Firstname
+	}
+	return ""
+}
+
+func (m *ListPeopleRequest) GetLastname() string {
+	if m != nil {
+		return m.Lastname
+	}
+	return ""
+}
+
+func (m *ListPeopleRequest) GetCity() string {
+	if m != nil {
+		return m.City
+	}
+	return ""
+}
+
+func (m *ListPeopleRequest) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *ListPeopleRequest) GetSort() string {
+	if m != nil {
+		return m.Sort
+	}
+	return ""
+}
+
+func (m *ListPeopleRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *ListPeopleRequest) GetOffset() int32 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+type ListPeopleResponse struct {
+	People []*Person `protobuf:"bytes,1,rep,name=people,proto3" json:"people,omitempty"`
+	// The number of people matching the filters.
+	Total                int32    `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListPeopleResponse) Reset()         { *m = ListPeopleResponse{} }
+func (m *ListPeopleResponse) String() string { return proto.CompactTextString(m) }
+func (*ListPeopleResponse) ProtoMessage()    {}
+func (*ListPeopleResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4c9e10cf24b1156d, []int{4}
+}
+
+func (m *ListPeopleResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListPeopleResponse.Unmarshal(m, b)
+}
+func (m *ListPeopleResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListPeopleResponse.Marshal(b, m, deterministic)
+}
+func (m *ListPeopleResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListPeopleResponse.Merge(m, src)
+}
+func (m *ListPeopleResponse) XXX_Size() int {
+	return xxx_messageInfo_ListPeopleResponse.Size(m)
+}
+func (m *ListPeopleResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListPeopleResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListPeopleResponse proto.InternalMessageInfo
+
+func (m *ListPeopleResponse) GetPeople() []*Person {
+	if m != nil {
+		return m.People
+	}
+	return nil
+}
+
+func (m *ListPeopleResponse) GetTotal() int32 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+type CreatePersonRequest struct {
+	Person               *Person  `protobuf:"bytes,1,opt,name=person,proto3" json:"person,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CreatePersonRequest) Reset()         { *m = CreatePersonRequest{} }
+func (m *CreatePersonRequest) String() string { return proto.CompactTextString(m) }
+func (*CreatePersonRequest) ProtoMessage()    {}
+func (*CreatePersonRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4c9e10cf24b1156d, []int{5}
+}
+
+func (m *CreatePersonRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CreatePersonRequest.Unmarshal(m, b)
+}
+func (m *CreatePersonRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CreatePersonRequest.Marshal(b, m, deterministic)
+}
+func (m *CreatePersonRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CreatePersonRequest.Merge(m, src)
+}
+func (m *CreatePersonRequest) XXX_Size() int {
+	return xxx_messageInfo_CreatePersonRequest.Size(m)
+}
+func (m *CreatePersonRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CreatePersonRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CreatePersonRequest proto.InternalMessageInfo
+
+func (m *CreatePersonRequest) GetPerson() *Person {
+	if m != nil {
+		return m.Person
+	}
+	return nil
+}
+
+type UpdatePersonRequest struct {
+	Person *Person `protobuf:"bytes,1,opt,name=person,proto3" json:"person,omitempty"`
+	// If set, the update only happens when it matches the stored version.
+	Version              int64    `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UpdatePersonRequest) Reset()         { *m = UpdatePersonRequest{} }
+func (m *UpdatePersonRequest) String() string { return proto.CompactTextString(m) }
+func (*UpdatePersonRequest) ProtoMessage()    {}
+func (*UpdatePersonRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4c9e10cf24b1156d, []int{6}
+}
+
+func (m *UpdatePersonRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UpdatePersonRequest.Unmarshal(m, b)
+}
+func (m *UpdatePersonRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UpdatePersonRequest.Marshal(b, m, deterministic)
+}
+func (m *UpdatePersonRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UpdatePersonRequest.Merge(m, src)
+}
+func (m *UpdatePersonRequest) XXX_Size() int {
+	return xxx_messageInfo_UpdatePersonRequest.Size(m)
+}
+func (m *UpdatePersonRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UpdatePersonRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UpdatePersonRequest proto.InternalMessageInfo
+
+func (m *UpdatePersonRequest) GetPerson() *Person {
+	if m != nil {
+		return m.Person
+	}
+	return nil
+}
+
+func (m *UpdatePersonRequest) GetVersion() int64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+type DeletePersonRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// If set, the delete only happens when it matches the stored version.
+	Version              int64    `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeletePersonRequest) Reset()         { *m = DeletePersonRequest{} }
+func (m *DeletePersonRequest) String() string { return proto.CompactTextString(m) }
+func (*DeletePersonRequest) ProtoMessage()    {}
+func (*DeletePersonRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4c9e10cf24b1156d, []int{7}
+}
+
+func (m *DeletePersonRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeletePersonRequest.Unmarshal(m, b)
+}
+func (m *DeletePersonRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeletePersonRequest.Marshal(b, m, deterministic)
+}
+func (m *DeletePersonRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeletePersonRequest.Merge(m, src)
+}
+func (m *DeletePersonRequest) XXX_Size() int {
+	return xxx_messageInfo_DeletePersonRequest.Size(m)
+}
+func (m *DeletePersonRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeletePersonRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeletePersonRequest proto.InternalMessageInfo
+
+func (m *DeletePersonRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *DeletePersonRequest) GetVersion() int64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+type DeletePersonResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeletePersonResponse) Reset()         { *m = DeletePersonResponse{} }
+func (m *DeletePersonResponse) String() string { return proto.CompactTextString(m) }
+func (*DeletePersonResponse) ProtoMessage()    {}
+func (*DeletePersonResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4c9e10cf24b1156d, []int{8}
+}
+
+func (m *DeletePersonResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeletePersonResponse.Unmarshal(m, b)
+}
+func (m *DeletePersonResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeletePersonResponse.Marshal(b, m, deterministic)
+}
+func (m *DeletePersonResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeletePersonResponse.Merge(m, src)
+}
+func (m *DeletePersonResponse) XXX_Size() int {
+	return xxx_messageInfo_DeletePersonResponse.Size(m)
+}
+func (m *DeletePersonResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeletePersonResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeletePersonResponse proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterType((*Address)(nil), "person.Address")
+	proto.RegisterType((*Person)(nil), "person.Person")
+	proto.RegisterType((*GetPersonRequest)(nil), "person.GetPersonRequest")
+	proto.RegisterType((*ListPeopleRequest)(nil), "person.ListPeopleRequest")
+	proto.RegisterType((*ListPeopleResponse)(nil), "person.ListPeopleResponse")
+	proto.RegisterType((*CreatePersonRequest)(nil), "person.CreatePersonRequest")
+	proto.RegisterType((*UpdatePersonRequest)(nil), "person.UpdatePersonRequest")
+	proto.RegisterType((*DeletePersonRequest)(nil), "person.DeletePersonRequest")
+	proto.RegisterType((*DeletePersonResponse)(nil), "person.DeletePersonResponse")
+}
+
+func init() { proto.RegisterFile("person.proto", fileDescriptor_4c9e10cf24b1156d) }
+
+var fileDescriptor_4c9e10cf24b1156d = []byte{
+	// 497 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0x5d, 0x6f, 0xd3, 0x30,
+	0x14, 0x9d, 0xd3, 0x36, 0xa5, 0x77, 0x30, 0xc0, 0x9d, 0xa6, 0x50, 0xf6, 0x50, 0xf9, 0x01, 0x05,
+	0x21, 0x1a, 0xe8, 0x1e, 0xf6, 0x80, 0xd0, 0xc4, 0x97, 0xf6, 0xc2, 0xc3, 0x94, 0x09, 0x21, 0xf1,
+	0x96, 0x35, 0xb7, 0xc5, 0x22, 0x8d, 0x83, 0x7d, 0x37, 0x89, 0x5f, 0xc2, 0x6f, 0xe1, 0xa7, 0xf1,
+	0x86, 0x62, 0xc7, 0xf4, 0x63, 0x51, 0x91, 0x78, 0x8a, 0xef, 0x3d, 0x3e, 0xd7, 0xc7, 0xe7, 0x58,
+	0x81, 0xbb, 0x15, 0x6a, 0xa3, 0xca, 0x49, 0xa5, 0x15, 0x29, 0x1e, 0xba, 0x4a, 0x9c, 0x40, 0xff,
+	0x4d, 0x9e, 0x6b, 0x34, 0x86, 0x73, 0xe8, 0xce, 0x24, 0xfd, 0x88, 0xd8, 0x98, 0xc5, 0x83, 0xd4,
+	0xae, 0xf9, 0x21, 0xf4, 0x0c, 0x65, 0x84, 0x51, 0x60, 0x9b, 0xae, 0x10, 0x3f, 0x19, 0x84, 0x17,
+	0x96, 0xcf, 0x0f, 0x20, 0x90, 0x79, 0x43, 0x09, 0x64, 0xce, 0x8f, 0x61, 0x30, 0x97, 0xda, 0x50,
+	0x99, 0x2d, 0x3d, 0x69, 0xd5, 0xe0, 0x23, 0xb8, 0x53, 0x64, 0x0d, 0xd8, 0xb1, 0xe0, 0xdf, 0x9a,
+	0x3f, 0x85, 0x7e, 0xe6, 0x94, 0x44, 0xdd, 0x31, 0x8b, 0xf7, 0xa7, 0xf7, 0x27, 0x8d, 0xe2, 0x46,
+	0x60, 0xea, 0x71, 0x1e, 0x41, 0xff, 0x06, 0xb5, 0x91, 0xaa, 0x8c, 0x7a, 0x63, 0x16, 0x77, 0x52,
+	0x5f, 0x0a, 0x01, 0x0f, 0xce, 0x91, 0x9c, 0xb6, 0x14, 0xbf, 0x5f, 0xa3, 0xa1, 0x6d, 0x89, 0xe2,
+	0x17, 0x83, 0x87, 0x1f, 0xa5, 0xa1, 0x0b, 0x54, 0x55, 0x81, 0x7e, 0xd7, 0x86, 0x70, 0xb6, 0x4b,
+	0x78, 0xb0, 0x25, 0xdc, 0xfb, 0xd6, 0x69, 0xf3, 0xad, 0xbb, 0xe6, 0x5b, 0xbd, 0xd3, 0x28, 0x4d,
+	0x56, 0xf4, 0x20, 0xb5, 0xeb, 0x7a, 0x67, 0x21, 0x97, 0x92, 0xa2, 0x70, 0xcc, 0xe2, 0x5e, 0xea,
+	0x0a, 0x7e, 0x04, 0xa1, 0x9a, 0xcf, 0x0d, 0x52, 0xd4, 0xb7, 0xed, 0xa6, 0x12, 0x29, 0xf0, 0x75,
+	0xe9, 0xa6, 0x52, 0xa5, 0x41, 0xfe, 0x04, 0xc2, 0xca, 0x76, 0x22, 0x36, 0xee, 0xc4, 0xfb, 0xd3,
+	0x03, 0xef, 0x5c, 0x63, 0x44, 0x83, 0xd6, 0x67, 0x91, 0xa2, 0xac, 0xb0, 0x57, 0xe8, 0xa5, 0xae,
+	0x10, 0xaf, 0x61, 0xf8, 0x4e, 0x63, 0x46, 0xb8, 0x69, 0x9b, 0x1d, 0x5a, 0x37, 0xac, 0x1b, 0xad,
+	0x43, 0xeb, 0xaf, 0xf8, 0x0c, 0xc3, 0x4f, 0x55, 0xfe, 0xbf, 0xf4, 0xf5, 0x2c, 0x83, 0xcd, 0x2c,
+	0xcf, 0x60, 0xf8, 0x1e, 0x0b, 0x24, 0xdc, 0x19, 0xe7, 0x8e, 0x01, 0x47, 0x70, 0xb8, 0x39, 0xc0,
+	0xd9, 0x35, 0xfd, 0x1d, 0xc0, 0x3d, 0xd7, 0xba, 0x44, 0x7d, 0x23, 0x67, 0xc8, 0x5f, 0x42, 0xe7,
+	0x1c, 0x89, 0x47, 0x5e, 0xe3, 0xf6, 0x1b, 0x1a, 0x6d, 0xa9, 0x17, 0x7b, 0xfc, 0x0c, 0xba, 0x75,
+	0x12, 0xfc, 0x91, 0x47, 0x6e, 0x3d, 0xa9, 0xd1, 0xa8, 0x0d, 0x72, 0x1a, 0xc4, 0x1e, 0x7f, 0x05,
+	0x70, 0x49, 0x1a, 0xb3, 0xe5, 0xbf, 0xc6, 0xdc, 0x3a, 0xfb, 0x05, 0xe3, 0xa7, 0x10, 0xba, 0xcc,
+	0xf8, 0x63, 0x8f, 0xb6, 0x64, 0xd8, 0x22, 0xfb, 0x14, 0x42, 0x97, 0xd6, 0x8a, 0xd8, 0x92, 0x5e,
+	0x0b, 0xf1, 0x03, 0x84, 0xce, 0xcc, 0x15, 0xb1, 0x25, 0x9d, 0xd1, 0x71, 0x3b, 0xe8, 0x6f, 0xfd,
+	0xf6, 0xf9, 0x97, 0x67, 0x0b, 0x49, 0x5f, 0xaf, 0xaf, 0x26, 0x33, 0xb5, 0x4c, 0x4a, 0x54, 0x06,
+	0xb1, 0xc0, 0x84, 0x64, 0x9e, 0x17, 0x68, 0x92, 0xea, 0xdb, 0x22, 0x59, 0xe8, 0x6a, 0x96, 0xb8,
+	0x29, 0x57, 0xa1, 0xfd, 0x5b, 0x9d, 0xfc, 0x19, 0x00, 0xfa, 0x6d, 0xb4, 0x42, 0xbd, 0x04, 0x00,
+	0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// PersonServiceClient is the client API for PersonService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type PersonServiceClient interface {
+	// Gets a person.
+	Get(ctx context.Context, in *GetPersonRequest, opts ...grpc.CallOption) (*Person, error)
+	// Lists the people matching the request.
+	List(ctx context.Context, in *ListPeopleRequest, opts ...grpc.CallOption) (*ListPeopleResponse, error)
+	// Streams the people matching the request, one message per person.
+	StreamList(ctx context.Context, in *ListPeopleRequest, opts ...grpc.CallOption) (PersonService_StreamListClient, error)
+	// Creates a person.
+	Create(ctx context.Context, in *CreatePersonRequest, opts ...grpc.CallOption) (*Person, error)
+	// Updates a person.
+	Update(ctx context.Context, in *UpdatePersonRequest, opts ...grpc.CallOption) (*Person, error)
+	// Deletes a person.
+	Delete(ctx context.Context, in *DeletePersonRequest, opts ...grpc.CallOption) (*DeletePersonResponse, error)
+}
+
+type personServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewPersonServiceClient(cc *grpc.ClientConn) PersonServiceClient {
+	return &personServiceClient{cc}
+}
+
+func (c *personServiceClient) Get(ctx context.Context, in *GetPersonRequest, opts ...grpc.CallOption) (*Person, error) {
+	out := new(Person)
+	err := c.cc.Invoke(ctx, "/person.PersonService/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *personServiceClient) List(ctx context.Context, in *ListPeopleRequest, opts ...grpc.CallOption) (*ListPeopleResponse, error) {
+	out := new(ListPeopleResponse)
+	err := c.cc.Invoke(ctx, "/person.PersonService/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *personServiceClient) StreamList(ctx context.Context, in *ListPeopleRequest, opts ...grpc.CallOption) (PersonService_StreamListClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_PersonService_serviceDesc.Streams[0], "/person.PersonService/StreamList", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &personServiceStreamListClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PersonService_StreamListClient interface {
+	Recv() (*Person, error)
+	grpc.ClientStream
+}
+
+type personServiceStreamListClient struct {
+	grpc.ClientStream
+}
+
+func (x *personServiceStreamListClient) Recv() (*Person, error) {
+	m := new(Person)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *personServiceClient) Create(ctx context.Context, in *CreatePersonRequest, opts ...grpc.CallOption) (*Person, error) {
+	out := new(Person)
+	err := c.cc.Invoke(ctx, "/person.PersonService/Create", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *personServiceClient) Update(ctx context.Context, in *UpdatePersonRequest, opts ...grpc.CallOption) (*Person, error) {
+	out := new(Person)
+	err := c.cc.Invoke(ctx, "/person.PersonService/Update", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *personServiceClient) Delete(ctx context.Context, in *DeletePersonRequest, opts ...grpc.CallOption) (*DeletePersonResponse, error) {
+	out := new(DeletePersonResponse)
+	err := c.cc.Invoke(ctx, "/person.PersonService/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PersonServiceServer is the server API for PersonService service.
+type PersonServiceServer interface {
+	// Gets a person.
+	Get(context.Context, *GetPersonRequest) (*Person, error)
+	// Lists the people matching the request.
+	List(context.Context, *ListPeopleRequest) (*ListPeopleResponse, error)
+	// Streams the people matching the request, one message per person.
+	StreamList(*ListPeopleRequest, PersonService_StreamListServer) error
+	// Creates a person.
+	Create(context.Context, *CreatePersonRequest) (*Person, error)
+	// Updates a person.
+	Update(context.Context, *UpdatePersonRequest) (*Person, error)
+	// Deletes a person.
+	Delete(context.Context, *DeletePersonRequest) (*DeletePersonResponse, error)
+}
+
+// UnimplementedPersonServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedPersonServiceServer struct {
+}
+
+func (*UnimplementedPersonServiceServer) Get(ctx context.Context, req *GetPersonRequest) (*Person, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (*UnimplementedPersonServiceServer) List(ctx context.Context, req *ListPeopleRequest) (*ListPeopleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (*UnimplementedPersonServiceServer) StreamList(req *ListPeopleRequest, srv PersonService_StreamListServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamList not implemented")
+}
+func (*UnimplementedPersonServiceServer) Create(ctx context.Context, req *CreatePersonRequest) (*Person, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (*UnimplementedPersonServiceServer) Update(ctx context.Context, req *UpdatePersonRequest) (*Person, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (*UnimplementedPersonServiceServer) Delete(ctx context.Context, req *DeletePersonRequest) (*DeletePersonResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+
+func RegisterPersonServiceServer(s *grpc.Server, srv PersonServiceServer) {
+	s.RegisterService(&_PersonService_serviceDesc, srv)
+}
+
+func _PersonService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPersonRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PersonServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/person.PersonService/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PersonServiceServer).Get(ctx, req.(*GetPersonRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PersonService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPeopleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PersonServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/person.PersonService/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PersonServiceServer).List(ctx, req.(*ListPeopleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PersonService_StreamList_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListPeopleRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PersonServiceServer).StreamList(m, &personServiceStreamListServer{stream})
+}
+
+type PersonService_StreamListServer interface {
+	Send(*Person) error
+	grpc.ServerStream
+}
+
+type personServiceStreamListServer struct {
+	grpc.ServerStream
+}
+
+func (x *personServiceStreamListServer) Send(m *Person) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PersonService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreatePersonRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PersonServiceServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/person.PersonService/Create",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PersonServiceServer).Create(ctx, req.(*CreatePersonRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PersonService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdatePersonRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PersonServiceServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/person.PersonService/Update",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PersonServiceServer).Update(ctx, req.(*UpdatePersonRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PersonService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeletePersonRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PersonServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/person.PersonService/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PersonServiceServer).Delete(ctx, req.(*DeletePersonRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _PersonService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "person.PersonService",
+	HandlerType: (*PersonServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _PersonService_Get_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _PersonService_List_Handler,
+		},
+		{
+			MethodName: "Create",
+			Handler:    _PersonService_Create_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _PersonService_Update_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _PersonService_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamList",
+			Handler:       _PersonService_StreamList_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "person.proto",
+}
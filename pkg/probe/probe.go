@@ -1,10 +1,13 @@
 package probe
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	g "github.com/neoseele/tiddles/pkg/grpc"
 
@@ -18,8 +21,56 @@ func Liveness(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Liveness probe hit\n")
 }
 
+// readinessCheck is an extra check run by the readiness probe
+type readinessCheck struct {
+	mu        sync.Mutex
+	name      string
+	check     func(ctx context.Context) error
+	timeout   time.Duration
+	threshold int
+	failures  int
+}
+
+var readiness *readinessCheck
+
+// InitReadiness makes the readiness probe run check (e.g. ping the database)
+// with the given timeout, the probe fails once check failed threshold times in a row
+func InitReadiness(name string, check func(ctx context.Context) error, timeout time.Duration, threshold int) {
+	if threshold < 1 {
+		threshold = 1
+	}
+	readiness = &readinessCheck{name: name, check: check, timeout: timeout, threshold: threshold}
+}
+
+// run the check, it returns the number of consecutive failures and the last error
+func (c *readinessCheck) run(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	err := c.check(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.failures++
+	} else {
+		c.failures = 0
+	}
+	return c.failures, err
+}
+
 // Readiness probe
 func Readiness(w http.ResponseWriter, r *http.Request) {
+	if readiness != nil {
+		failures, err := readiness.run(r.Context())
+		if err != nil {
+			log.Printf("Readiness : %s check failed (%d/%d): %s\n", readiness.name, failures, readiness.threshold, err)
+			if failures >= readiness.threshold {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, "Readiness probe failed: %s: %s\n", readiness.name, err)
+				return
+			}
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Readiness probe hit\n")
 }
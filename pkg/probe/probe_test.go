@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadinessThreshold(t *testing.T) {
+	defer func() { readiness = nil }()
+
+	var fail bool
+	InitReadiness("db", func(ctx context.Context) error {
+		if fail {
+			return errors.New("down")
+		}
+		return nil
+	}, time.Second, 2)
+
+	for i, tt := range []struct {
+		fail   bool
+		status int
+	}{
+		{false, http.StatusOK},
+		// a single failure is tolerated
+		{true, http.StatusOK},
+		{true, http.StatusServiceUnavailable},
+		{true, http.StatusServiceUnavailable},
+		// a success resets the count
+		{false, http.StatusOK},
+		{true, http.StatusOK},
+	} {
+		fail = tt.fail
+		w := httptest.NewRecorder()
+		Readiness(w, httptest.NewRequest("GET", "/readiness", nil))
+		if w.Code != tt.status {
+			t.Errorf("probe %d: got status %d, want %d", i, w.Code, tt.status)
+		}
+	}
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	defer func() { readiness = nil }()
+
+	// the check is given the timeout, a threshold below 1 fails at once
+	InitReadiness("db", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 10*time.Millisecond, 0)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	Readiness(w, httptest.NewRequest("GET", "/readiness", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503", w.Code)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("the probe took %s", d)
+	}
+}